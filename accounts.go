@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"io"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/bishopfox/knownawsaccountslookup"
+)
+
+// organizationTargets returns the active accounts of the caller's AWS Organization.
+func organizationTargets(ctx context.Context, cfg aws.Config) ([]scanner.AccountTarget, error) {
+	accounts, err := scanner.ListAccounts(ctx, organizations.NewFromConfig(cfg))
+	if err != nil {
+		return nil, err
+	}
+	targets := make([]scanner.AccountTarget, 0, len(accounts))
+	for _, account := range accounts {
+		targets = append(targets, scanner.AccountTarget{ID: account})
+	}
+	return targets, nil
+}
+
+// scanAccounts scans each target account with credentials from sts:AssumeRole, called with the base credentials in
+// cfg. See scanner.NewAccountScanner for the role assumed in each account.
+func scanAccounts(ctx context.Context, cfg aws.Config, identity scanner.Identity, targets []scanner.AccountTarget,
+	roleName string, concurrency int, opts scanner.Options) *scanner.Result {
+	logger.Info("Scanning accounts", "accounts", len(targets), "role", roleName)
+
+	// Load the known vendors once rather than for every account
+	if opts.Vendors == nil {
+		opts.Vendors = knownawsaccountslookup.NewVendorMap()
+		opts.Vendors.PopulateKnownAWSAccounts()
+	}
+	byID := make(map[string]scanner.AccountTarget, len(targets))
+	accounts := make([]string, 0, len(targets))
+	for _, target := range targets {
+		byID[target.ID] = target
+		accounts = append(accounts, target.ID)
+	}
+	stsClient := sts.NewFromConfig(cfg)
+	return scanner.ScanAccounts(ctx, identity, accounts, scanner.AccountScanOptions{
+		Concurrency: concurrency,
+		Progress:    opts.Progress,
+		Logger:      opts.Logger,
+		NewScanner: func(ctx context.Context, account string, progress io.Writer) (*scanner.Scanner, error) {
+			accountOpts := opts
+			accountOpts.Progress = progress
+			return scanner.NewAccountScanner(cfg, identity, byID[account], roleName, stsClient, accountOpts), nil
+		},
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// logFormats are the values accepted by --log-format.
+var logFormats = []string{"console", "text", "json"}
+
+// newLogger returns a logger writing records of at least the given level to w. The console format is meant for
+// people reading the terminal, while text (logfmt) and json are meant for log pipelines.
+func newLogger(format string, level slog.Level, w io.Writer) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "console":
+		return slog.New(newConsoleHandler(w, level)), nil
+	case "text":
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q (supported formats: %s)", format, strings.Join(logFormats, ", "))
+	}
+}
+
+// consoleHandler is a slog.Handler for people reading the terminal. It writes one line per record, prefixed and
+// coloured by level like the rest of the tool's output, followed by the record's attributes as key=value pairs.
+type consoleHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+func newConsoleHandler(w io.Writer, level slog.Leveler) *consoleHandler {
+	return &consoleHandler{mu: &sync.Mutex{}, w: w, level: level}
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	var line strings.Builder
+	line.WriteString(record.Message)
+	appendAttr := func(attr slog.Attr) bool {
+		if attr.Equal(slog.Attr{}) {
+			return true
+		}
+		value := attr.Value.Resolve().String()
+		if strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&line, " %s=%s", attr.Key, value)
+		return true
+	}
+	for _, attr := range h.attrs {
+		appendAttr(attr)
+	}
+	record.Attrs(appendAttr)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var err error
+	switch {
+	case record.Level >= slog.LevelError:
+		_, err = red.Fprintf(h.w, "[!] %s\n", line.String())
+	case record.Level >= slog.LevelWarn:
+		_, err = yellow.Fprintf(h.w, "[!] %s\n", line.String())
+	case record.Level >= slog.LevelInfo:
+		_, err = fmt.Fprintf(h.w, "[*] %s\n", line.String())
+	default:
+		_, err = yellow.Fprintf(h.w, "[DEBUG] %s\n", line.String())
+	}
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &clone
+}
+
+// WithGroup is not needed by the tool's messages, so groups are flattened into the parent.
+func (h *consoleHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+var (
+	red    = color.New(color.FgRed)
+	yellow = color.New(color.FgYellow)
+)
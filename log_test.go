@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/fatih/color"
+)
+
+func TestConsoleHandler(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() { color.NoColor = noColor })
+
+	tests := []struct {
+		name  string
+		level slog.Level
+		log   func(*slog.Logger)
+		want  string
+	}{
+		{"debug", slog.LevelDebug, func(l *slog.Logger) { l.Debug("Scanning region", "region", "us-east-1") },
+			"[DEBUG] Scanning region region=us-east-1\n"},
+		{"info", slog.LevelDebug, func(l *slog.Logger) { l.Info("Scan complete", "amis", 3) },
+			"[*] Scan complete amis=3\n"},
+		{"warn", slog.LevelDebug, func(l *slog.Logger) { l.Warn("Region skipped", "error", "opt-in required") },
+			"[!] Region skipped error=\"opt-in required\"\n"},
+		{"error", slog.LevelDebug, func(l *slog.Logger) { l.Error("Scan failed", "filter", "owner=self") },
+			"[!] Scan failed filter=\"owner=self\"\n"},
+		{"handler attributes come first", slog.LevelDebug,
+			func(l *slog.Logger) { l.With("account", testAccount).Info("Scanning account", "role", "audit") },
+			"[*] Scanning account account=111111111111 role=audit\n"},
+		{"below the level", slog.LevelInfo, func(l *slog.Logger) { l.Debug("Scanning region") }, ""},
+		{"warn at the warn level", slog.LevelWarn, func(l *slog.Logger) { l.Info("Scan complete"); l.Warn("Region skipped") },
+			"[!] Region skipped\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			tt.log(slog.New(newConsoleHandler(&out, tt.level)))
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	for _, format := range logFormats {
+		if _, err := newLogger(format, slog.LevelInfo, io.Discard); err != nil {
+			t.Errorf("newLogger(%q) error = %v", format, err)
+		}
+	}
+	if _, err := newLogger("logfmt", slog.LevelInfo, io.Discard); err == nil {
+		t.Error(`newLogger("logfmt") succeeded, want an error`)
+	}
+}
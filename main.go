@@ -2,79 +2,154 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"github.com/DataDog/whoAMI-scanner/report"
+	"github.com/DataDog/whoAMI-scanner/scanner"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/ec2"
-	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
-	"github.com/aws/smithy-go/ptr"
-	"github.com/bishopfox/knownawsaccountslookup"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/securityhub"
 	"github.com/fatih/color"
 	"github.com/kyokomi/emoji"
+	"github.com/mattn/go-isatty"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"time"
 )
 
-var (
-	verbose                    bool
-	version                    = "1.0.0"
-	cyan                       = color.New(color.FgCyan).SprintFunc()
-	green                      = color.New(color.FgGreen).SprintFunc()
-	yellow                     = color.New(color.FgYellow).SprintFunc()
-	red                        = color.New(color.FgRed).SprintFunc()
-	amiToInstanceMap           = make(map[string][]Instance)
-	allowedAMIPermissionDenied = false
-)
-
+// Exit codes, documented in the README.
 const (
-	AmiOwnerNameUnknown = "Unknown"
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2 // same as the flag package
+	exitCredentials = 3
+	exitFindings    = 4
+	exitIncomplete  = 5
 )
 
-type AMI struct {
-	ID          string
-	Region      string
-	OwnerAlias  string
-	OwnerID     string
-	OwnerName   string
-	Name        string
-	Description string
-	Public      string
-}
-
-type Instance struct {
-	ID     string
-	Region string
-	Name   string
-}
+var (
+	version = "1.0.0"
+	cyan    = color.New(color.FgCyan).SprintFunc()
+	// logger writes diagnostics to stderr. Until the flags are parsed, it logs at the info level.
+	logger = slog.New(newConsoleHandler(color.Error, slog.LevelInfo))
+)
 
 func main() {
 	// Parse command-line arguments
 	var profile string
 	var region string
 	var output string
-	var vendors *knownawsaccountslookup.Vendors
+	var format string
+	var delimiterInput string
+	var markdownMaxLength int
+	var publishSecurityHub bool
+	var securityHubRegion string
+	var concurrency int
+	var retryModeInput string
+	var maxAttempts int
+	var failOnInput string
+	var reports reportTargets
+	var failIfAllowedAMIsDisabled bool
+	var verbose bool
+	var quiet bool
+	var logLevelInput string
+	var logFormat string
+	var noColor bool
+	var org bool
+	var orgRoleName string
+	var accountConcurrency int
+	var accountsFile string
+	var trustOrganization bool
+	var trustOrganizationOUsInput string
 
 	var trustedAccountsInput string
+	var trustPolicyFile string
 	flag.StringVar(&profile, "profile", "", "AWS profile name [Default: Default profile, IMDS, or environment variables]")
 	flag.StringVar(&region, "region", "", "AWS region [Default: All regions]")
-	flag.StringVar(&trustedAccountsInput, "trusted-accounts", "", "Comma-separated list of AWS account IDs that are allowed to share AMIs")
-	flag.BoolVar(&verbose, "verbose", false, "Enable verbose output for detailed status updates")
-	flag.StringVar(&output, "output", "", "Specify file path/name for csv report)")
+	flag.StringVar(&trustedAccountsInput, "trusted-accounts", "", "Comma-separated list of AWS account IDs that are allowed to share AMIs; see --trust-policy for labels, scopes and expiry dates")
+	flag.StringVar(&trustPolicyFile, "trust-policy", "", "YAML or JSON trust policy file listing the trusted AMI owners, with optional labels, image name patterns, scopes and expiry dates")
+	flag.BoolVar(&trustOrganization, "trust-organization", false, "Trust AMIs owned by the other accounts of the caller's AWS Organization")
+	flag.StringVar(&trustOrganizationOUsInput, "trust-organization-ous", "", "Comma-separated list of organizational unit IDs; with --trust-organization, only the accounts under them are trusted")
+	flag.BoolVar(&verbose, "verbose", false, "Enable verbose output for detailed status updates; same as --log-level debug")
+	flag.BoolVar(&quiet, "quiet", false, "Only log warnings and errors; do not print the banner, summary or hints")
+	flag.StringVar(&logLevelInput, "log-level", "", "Minimum level of logged messages: debug, info, warn or error [Default: info, debug with --verbose, warn with --quiet]")
+	flag.StringVar(&logFormat, "log-format", "console", fmt.Sprintf("Format of logged messages: %s. Only the console format prints the banner, summary and hints", strings.Join(logFormats, ", ")))
+	flag.BoolVar(&noColor, "no-color", false, "Disable coloured output [Default: colour when stderr is a terminal and NO_COLOR is not set]")
+	flag.StringVar(&output, "output", "", "Specify file path/name for report")
+	flag.StringVar(&format, "format", "csv", fmt.Sprintf("Report format for --output: %s", strings.Join(report.Formats(), ", ")))
+	flag.Var(&reports, "report", "Write a report as format=path, e.g. sarif=out/scan.sarif. Can be repeated")
+	flag.StringVar(&delimiterInput, "csv-delimiter", ",", "Field delimiter for CSV reports, a single character or \"tab\"")
+	flag.IntVar(&markdownMaxLength, "markdown-max-length", report.DefaultMarkdownMaxLength, "Maximum length of Markdown reports in characters, e.g. 32767 for Jira comments")
+	flag.BoolVar(&publishSecurityHub, "publish-securityhub", false, "Import findings into AWS Security Hub and archive findings for AMIs no longer in use")
+	flag.StringVar(&securityHubRegion, "securityhub-region", "", "Security Hub region for --publish-securityhub and --format asff [Default: --region, or us-east-1]")
+	flag.IntVar(&concurrency, "concurrency", 4, "Number of regions to scan in parallel")
+	flag.BoolVar(&org, "org", false, "Scan every active account of the AWS Organization, assuming --org-role-name in each")
+	flag.StringVar(&orgRoleName, "org-role-name", "OrganizationAccountAccessRole", "Name of the IAM role assumed in each account with --org, or --accounts-file when an account has no role_arn")
+	flag.StringVar(&accountsFile, "accounts-file", "", "YAML or JSON file listing the accounts to scan, with the role to assume in each")
+	flag.IntVar(&accountConcurrency, "account-concurrency", 2, "Number of accounts to scan in parallel with --org or --accounts-file")
+	flag.StringVar(&retryModeInput, "retry-mode", string(aws.RetryModeAdaptive), "AWS API retry mode: standard or adaptive (client-side rate limiting when throttled)")
+	flag.IntVar(&maxAttempts, "max-attempts", 10, "Maximum number of attempts for each AWS API call before giving up")
+	flag.StringVar(&failOnInput, "fail-on", "", fmt.Sprintf("Comma-separated list of AMI statuses that make the scan exit with %d, e.g. unverified,private-shared", exitFindings))
+	flag.BoolVar(&failIfAllowedAMIsDisabled, "fail-if-allowed-amis-disabled", false, fmt.Sprintf("Exit with %d if Allowed AMIs is disabled in any scanned region", exitFindings))
 	flag.Parse()
 
-	// Print tool name and version in a bit of a fancy way
-	//color.Cyan(emoji.Sprintf(":eyes:whoAMI-scanner v%s :eyes:\n", version))
+	// Everything but reports goes to stderr, so stdout only carries a report written to "-" and can be piped into
+	// tools such as jq
+	color.Output = color.Error
+	color.NoColor = noColor || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" ||
+		!isatty.IsTerminal(os.Stderr.Fd()) && !isatty.IsCygwinTerminal(os.Stderr.Fd())
+	level := slog.LevelInfo
+	switch {
+	case logLevelInput != "":
+		if err := level.UnmarshalText([]byte(logLevelInput)); err != nil {
+			logger.Error("Invalid --log-level", "error", err)
+			os.Exit(exitUsage)
+		}
+	case quiet:
+		level = slog.LevelWarn
+	case verbose:
+		level = slog.LevelDebug
+	}
+	configuredLogger, err := newLogger(logFormat, level, color.Error)
+	if err != nil {
+		logger.Error("Invalid --log-format", "error", err)
+		os.Exit(exitUsage)
+	}
+	logger = configuredLogger
+	verbose = level <= slog.LevelDebug
+	// The banner, summary and hints are only printed next to console logs, so structured logs stay parseable
+	quiet = quiet || logFormat != "console"
+
+	failOn, err := parseStatuses(failOnInput)
+	if err != nil {
+		logger.Error("Invalid --fail-on", "error", err)
+		os.Exit(exitUsage)
+	}
 
 	if output != "" {
-		PreparePath(output)
+		if err := reports.Set(format + "=" + output); err != nil {
+			logger.Error("Invalid --format", "error", err)
+			os.Exit(exitUsage)
+		}
+	}
+	// Create the directories of every report before scanning, so a bad path fails fast
+	switch err := reports.prepare(); {
+	case errors.Is(err, errDuplicateReportPath):
+		logger.Error("More than one report is written to the same path", "error", err)
+		os.Exit(exitUsage)
+	case err != nil:
+		logger.Error("Error preparing report path", "error", err)
+		os.Exit(exitError)
 	}
-
-	vendors = knownawsaccountslookup.NewVendorMap()
-	vendors.PopulateKnownAWSAccounts()
 
 	var trustedAccounts []string
 	if trustedAccountsInput != "" {
@@ -83,353 +158,271 @@ func main() {
 		for i, account := range trustedAccounts {
 			trustedAccounts[i] = strings.TrimSpace(account)
 		}
-		if verbose {
-			fmt.Printf("[*] User provided trusted accounts: %v\n", trustedAccounts)
+		logger.Debug("User provided trusted accounts", "accounts", strings.Join(trustedAccounts, ","))
+	}
+	var trustPolicy *scanner.TrustPolicy
+	if trustPolicyFile != "" {
+		trustPolicy, err = scanner.LoadTrustPolicy(trustPolicyFile)
+		if err != nil {
+			logger.Error("Invalid --trust-policy", "error", err)
+			os.Exit(exitUsage)
+		}
+		// Expired rules are kept in the file as a record and simply stop trusting their owner
+		for _, rule := range trustPolicy.Expired(time.Now()) {
+			logger.Warn("Trust policy rule has expired and is ignored", "rule", rule.Source, "label", rule.Label,
+				"expires", rule.Expires.Format(time.RFC3339))
 		}
+		logger.Debug("Loaded trust policy", "path", trustPolicyFile, "rules", len(trustPolicy.Rules))
+	}
+
+	if org && accountsFile != "" {
+		logger.Error("--org and --accounts-file cannot be used together")
+		os.Exit(exitUsage)
+	}
+	var accountTargets []scanner.AccountTarget
+	if accountsFile != "" {
+		accountTargets, err = scanner.LoadAccountsFile(accountsFile)
+		if err != nil {
+			logger.Error("Invalid --accounts-file", "error", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	var ous []string
+	for _, ou := range strings.Split(trustOrganizationOUsInput, ",") {
+		if ou = strings.TrimSpace(ou); ou != "" {
+			ous = append(ous, ou)
+		}
+	}
+	if len(ous) > 0 && !trustOrganization {
+		logger.Error("--trust-organization-ous requires --trust-organization")
+		os.Exit(exitUsage)
+	}
+
+	retryMode, err := aws.ParseRetryMode(retryModeInput)
+	if err != nil {
+		logger.Error("Invalid --retry-mode", "error", err)
+		os.Exit(exitUsage)
+	}
+	if maxAttempts < 1 {
+		logger.Error("Invalid --max-attempts: it must be at least 1", "value", maxAttempts)
+		os.Exit(exitUsage)
+	}
+
+	delimiter, err := report.ParseDelimiter(delimiterInput)
+	if err != nil {
+		logger.Error("Invalid --csv-delimiter", "error", err)
+		os.Exit(exitUsage)
+	}
+	if markdownMaxLength < 1 {
+		logger.Error("Invalid --markdown-max-length: it must be at least 1", "value", markdownMaxLength)
+		os.Exit(exitUsage)
 	}
 
 	// Enhanced credential loading with Windows-specific debugging
-	cfg, err := loadAWSConfig(profile, verbose)
+	cfg, err := loadAWSConfig(profile, retryMode, maxAttempts)
 	if err != nil {
-		color.Red("Error loading AWS config: %v", err)
-		os.Exit(1)
+		logger.Error("Error loading AWS config", "error", err)
+		os.Exit(exitCredentials)
 	}
 
+	opts := scanner.Options{
+		TrustedAccounts: trustedAccounts,
+		TrustPolicy:     trustPolicy,
+		Verbose:         verbose,
+		Progress:        color.Output,
+		Logger:          logger,
+		Concurrency:     concurrency,
+	}
+	if quiet {
+		opts.Progress = io.Discard
+	}
 	if region != "" {
 		cfg.Region = region
+		opts.Regions = []string{region}
 	}
-
-	ec2Client := ec2.NewFromConfig(cfg)
-	stsClient := sts.NewFromConfig(cfg)
+	// New copies the options, so everything the scan classifies with must be loaded first
+	if trustOrganization {
+		opts.Organization, err = scanner.LoadOrganizationTrust(context.TODO(), organizations.NewFromConfig(cfg), ous)
+		if err != nil {
+			logger.Error("Error listing the accounts to trust with --trust-organization", "request_id",
+				scanner.RequestID(err), "error", err)
+			os.Exit(exitError)
+		}
+		logger.Debug("Trusting organization accounts", "organization", opts.Organization.ID,
+			"accounts", len(opts.Organization.Accounts))
+	}
+	s := scanner.New(cfg, opts)
 
 	// Get account ID with enhanced error handling
-	callerIdentity, err := stsClient.GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	callerIdentity, err := s.Identity(context.TODO())
 	if err != nil {
-		color.Red("Error fetching account ID: %v", err)
-		if verbose {
-			color.Yellow("[DEBUG] This might be a Windows credential resolution issue.")
-			color.Yellow("[DEBUG] Try running with explicit AWS credentials:")
-			color.Yellow("[DEBUG]   set AWS_ACCESS_KEY_ID=your_access_key")
-			color.Yellow("[DEBUG]   set AWS_SECRET_ACCESS_KEY=your_secret_key")
-			color.Yellow("[DEBUG]   set AWS_SESSION_TOKEN=your_session_token (if using temporary credentials)")
-			color.Yellow("[DEBUG] Or ensure your AWS CLI credentials are properly configured.")
-		}
-		os.Exit(1)
+		logger.Error("Error fetching account ID", "request_id", scanner.RequestID(err), "error", err)
+		logger.Debug("This might be a Windows credential resolution issue. Try running with explicit AWS credentials:")
+		logger.Debug("  set AWS_ACCESS_KEY_ID=your_access_key")
+		logger.Debug("  set AWS_SECRET_ACCESS_KEY=your_secret_key")
+		logger.Debug("  set AWS_SESSION_TOKEN=your_session_token (if using temporary credentials)")
+		logger.Debug("Or ensure your AWS CLI credentials are properly configured.")
+		os.Exit(exitCredentials)
 	}
-	_ = *callerIdentity.Account
 
-	fmt.Printf("[%s] %s", cyan(emoji.Sprintf(" :eyes:whoAMI-scanner v%s :eyes:", version)),
-		fmt.Sprintf("AWS Caller Identity: %s\n", aws.ToString(callerIdentity.Arn)))
+	if !quiet {
+		fmt.Fprintf(color.Output, "[%s] %s", cyan(emoji.Sprintf(" :eyes:whoAMI-scanner v%s :eyes:", version)),
+			fmt.Sprintf("AWS Caller Identity: %s\n", callerIdentity.Arn))
+	}
 
 	if verbose {
-		fmt.Println("[*] Verbose mode enabled.")
+		logger.Info("Verbose mode enabled.")
 	} else {
-		fmt.Println("[*] Verbose mode disabled. Only unknown and unverified AMIs will be displayed.")
+		logger.Info("Verbose mode disabled. Only unknown and unverified AMIs will be displayed.")
 	}
 
-	// Fetch regions
-	var regions []string
-	if region == "" {
-		describeRegionsOutput, err := ec2Client.DescribeRegions(context.TODO(), &ec2.DescribeRegionsInput{})
+	logger.Info("Starting AMI analysis...")
+	if org {
+		accountTargets, err = organizationTargets(context.TODO(), cfg)
 		if err != nil {
-			color.Red("Error fetching regions: %v", err)
-			os.Exit(1)
-		}
-		for _, r := range describeRegionsOutput.Regions {
-			regions = append(regions, *r.RegionName)
+			logger.Error("Error listing organization accounts", "request_id", scanner.RequestID(err), "error", err)
+			os.Exit(exitError)
 		}
+	}
+	var result *scanner.Result
+	if org || accountsFile != "" {
+		result = scanAccounts(context.TODO(), cfg, *callerIdentity, accountTargets, orgRoleName, accountConcurrency, opts)
 	} else {
-		regions = []string{region}
-	}
-
-	processedAMIs := make(map[string]bool)
-	verifiedAMIs := make(map[string]AMI)
-	unverifiedAMIs := make(map[string]AMI)
-	unverifiedButKnownAMIs := make(map[string]AMI)
-	unknownAMIs := make(map[string]AMI)
-	selfHostedAMIs := make(map[string]AMI)
-	alllowedAMIs := make(map[string]AMI)
-	trustedAMIs := make(map[string]AMI)
-	privateSharedAMIs := make(map[string]AMI)
-	allowedAMIAccountsByRegion := make(map[string][]string)
-	allowedAMIStateByRegion := make(map[string]string)
-	totalInstances := 0
-
-	fmt.Println("[*] Starting AMI analysis...")
-	// Loop through regions
-	for _, region := range regions {
-		//if verbose {
-		//	fmt.Printf("[*] Checking region %s\n", region)
-		//}
-		cfg.Region = region
-		ec2Client := ec2.NewFromConfig(cfg)
-
-		allowedAMIsState, allowedAMIAccounts, err := CheckAllowedAMIs(ec2Client)
-		allowedAMIStateByRegion[region] = allowedAMIsState
-		allowedAMIAccountsByRegion[region] = allowedAMIAccounts
+		result, err = s.Scan(context.TODO())
 		if err != nil {
-			if strings.Contains(err.Error(), "UnauthorizedOperation") {
-				if !allowedAMIPermissionDenied {
-					color.Red("[!] Error calling ec2:GetAllowedImagesSettings. Check to see if %s has this permission", aws.ToString(callerIdentity.Arn))
-					color.Red("[!] Skipping allowed AMI checks for all regions.")
-					allowedAMIPermissionDenied = true
-					allowedAMIsState = "Permission Denied"
-				}
-			} else {
-				color.Red("[!] [%s] Error calling ec2:GetAllowedImagesSettings: %v", region, err)
-			}
-		} else if allowedAMIsState == "enabled" {
-			if verbose {
-				fmt.Printf("[*] [%s] Allowed AMI Accounts status: %s\n", region, green("Enabled"))
-			}
-		} else if allowedAMIsState == "audit-mode" {
-			if verbose {
-				fmt.Printf("[*] [%s] Allowed AMI Accounts status: %s\n", region, yellow("Audit mode"))
-			}
-		} else {
-			if verbose {
-				fmt.Printf("[*] [%s] Allowed AMI Accounts status: %s\n", region, red(("Disabled")))
-			}
+			logger.Error("Error scanning", "request_id", scanner.RequestID(err), "error", err)
+			os.Exit(exitError)
 		}
+	}
 
+	if !quiet {
+		printSummary(result)
+	}
 
-		// Fetch instances
-		instancesOutput, err := ec2Client.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{})
-		if err != nil {
-			color.Red("Error fetching instances for region %s: %v", region, err)
-			continue
+	if securityHubRegion == "" {
+		securityHubRegion = cfg.Region
+	}
+	reportOpts := report.Options{
+		ToolVersion:       version,
+		Delimiter:         delimiter,
+		SecurityHubRegion: securityHubRegion,
+		MarkdownMaxLength: markdownMaxLength,
+	}
+
+	// Every report is rendered from the same result
+	for _, target := range reports {
+		if err := writeReport(target.path, target.format, result, reportOpts); err != nil {
+			logger.Error("Error creating output file", "path", target.path, "error", err)
+			os.Exit(exitError)
 		}
+		// PreparePath made the path absolute, so the user knows exactly where the file was written
+		logger.Info("Output written", "path", target.path, "format", target.format)
+	}
 
-		instanceIDs := []string{}
-		for _, reservation := range instancesOutput.Reservations {
-			for _, instance := range reservation.Instances {
-				instanceIDs = append(instanceIDs, *instance.InstanceId)
-				amiID := *instance.ImageId
-				name := ""
-				// Get the name of the instance if it exists from the tags
-				for _, tag := range instance.Tags {
-					if *tag.Key == "Name" {
-						name = aws.ToString(tag.Value)
-					}
-				}
-				// Check if the instance already exists in the map
-				exists := false
-				for _, inst := range amiToInstanceMap[amiID] {
-					if inst.ID == aws.ToString(instance.InstanceId) {
-						exists = true
-						break
-					}
-				}
-				if !exists {
-					amiToInstanceMap[amiID] = append(amiToInstanceMap[amiID], Instance{
-						ID:     aws.ToString(instance.InstanceId),
-						Region: region,
-						Name:   name,
-					})
-				}
-			}
+	if publishSecurityHub {
+		client := securityhub.NewFromConfig(cfg, func(o *securityhub.Options) {
+			o.Region = securityHubRegion
+		})
+		summary, err := report.PublishSecurityHub(context.TODO(), client, result, reportOpts)
+		if err != nil {
+			logger.Error("Error publishing findings to Security Hub", "request_id", scanner.RequestID(err), "error", err)
+			os.Exit(exitError)
 		}
+		logger.Info("Published findings to Security Hub", "region", securityHubRegion, "imported", summary.Imported,
+			"archived", summary.Archived)
+	}
+
+	if !quiet {
+		printAllowedAMIsHint(result)
+	}
 
-		totalInstances += len(instanceIDs)
-		if len(instanceIDs) == 0 {
+	os.Exit(exitCode(result, failOn, failIfAllowedAMIsDisabled))
+}
+
+// parseStatuses parses a comma-separated list of status codes, such as "unverified,private-shared".
+func parseStatuses(input string) (map[scanner.Status]bool, error) {
+	statuses := make(map[scanner.Status]bool)
+	for _, code := range strings.Split(input, ",") {
+		code = strings.TrimSpace(code)
+		if code == "" {
 			continue
 		}
+		status, err := scanner.ParseStatus(code)
+		if err != nil {
+			return nil, err
+		}
+		statuses[status] = true
+	}
+	return statuses, nil
+}
 
-		for i, instanceID := range instanceIDs {
-			var publicString string
-			// Fetch instance details
-			instanceDetail, err := ec2Client.DescribeInstances(context.TODO(), &ec2.DescribeInstancesInput{
-				InstanceIds: []string{instanceID},
-			})
-			if err != nil {
-				color.Red("Error fetching details for instance %s: %v", instanceID, err)
-				continue
-			}
+// exitCode applies the --fail-on and --fail-if-allowed-amis-disabled policies to the scan result and prints why the
+// scan fails, if it does. Policy violations take precedence over an incomplete scan, as they are certain.
+func exitCode(result *scanner.Result, failOn map[scanner.Status]bool, failIfAllowedAMIsDisabled bool) int {
+	var violations []string
+	counts := result.CountByStatus()
+	for _, status := range scanner.Statuses {
+		if failOn[status] && counts[status] > 0 {
+			violations = append(violations, fmt.Sprintf("%d %s AMIs in use", counts[status], status.Code()))
+		}
+	}
+	if failIfAllowedAMIsDisabled {
+		if result.AllowedAMIPermissionDenied {
+			violations = append(violations, "the Allowed AMIs state could not be read (permission denied)")
+		} else if disabled := countRegionsWithAllowedAMIsDisabled(result); disabled > 0 {
+			violations = append(violations, fmt.Sprintf("Allowed AMIs is disabled in %d regions", disabled))
+		}
+	}
 
-			for _, reservation := range instanceDetail.Reservations {
-				for _, instance := range reservation.Instances {
-					amiID := *instance.ImageId
-
-					if processedAMIs[amiID] {
-						if verbose {
-							color.Cyan("[%d/%d][%s] %s already processed. Skipping.", i+1, len(instanceIDs), region, amiID)
-						}
-						continue
-					}
-					processedAMIs[amiID] = true
-					var ami AMI
-
-					if verbose {
-						fmt.Printf("[%d/%d][%s] %s being analyzed (Instance: %s)\n", i+1, len(instanceIDs), region, amiID, instanceID)
-					}
-					// Fetch AMI details
-					imageOutput, err := ec2Client.DescribeImages(context.TODO(), &ec2.DescribeImagesInput{
-						ImageIds: []string{amiID},
-					})
-					if err != nil {
-						if verbose {
-							color.Red("Error fetching AMI details for %s: %v", amiID, err)
-						}
-						continue
-					}
-
-					if len(imageOutput.Images) > 0 {
-						for _, image := range imageOutput.Images {
-							if *image.Public {
-								publicString = "Public"
-							} else {
-								publicString = "Private"
-							}
-							// lookup the vendor name and use that for ownerName if it exists otherwise set it to "unknown"
-							ownerName := vendors.GetVendorNameFromAccountID(*image.OwnerId)
-							if ownerName == "" {
-								ownerName = AmiOwnerNameUnknown
-							}
-							ami = AMI{
-								ID:          amiID,
-								Region:      region,
-								OwnerAlias:  ptr.ToString(image.ImageOwnerAlias),
-								OwnerID:     ptr.ToString(image.OwnerId),
-								OwnerName:   ownerName,
-								Name:        ptr.ToString(image.Name),
-								Description: ptr.ToString(image.Description),
-								Public:      publicString,
-							}
-						}
-					} else {
-						// try to get the info via the instance metadata instead
-						instanceImageOutput, err := ec2Client.DescribeInstanceImageMetadata(context.TODO(),
-							&ec2.DescribeInstanceImageMetadataInput{
-								InstanceIds: []string{aws.ToString(instance.InstanceId)},
-							})
-						if err != nil {
-							color.Red("An AMI was found that is not public. "+
-								"We tried `ec2:DescribeInstanceImageMetadata` but did not have permission. "+
-								"AMI ID: %s: Error: %v", amiID, err)
-							continue
-						}
-						for _, instance := range instanceImageOutput.InstanceImageMetadata {
-							if *instance.ImageMetadata.IsPublic {
-								publicString = "Public"
-							} else {
-								publicString = "Private"
-							}
-							// lookup the vendor name and use that for ownerName if it exists otherwise set it to "unknown"
-							ownerName := vendors.GetVendorNameFromAccountID(*instance.ImageMetadata.OwnerId)
-							if ownerName == "" {
-								ownerName = AmiOwnerNameUnknown
-							}
-
-							var imageOwnerAlias string
-							// if instance.ImageMetadata.ImageOwnerAlias is the account ID then change it to ""
-							// This is required because if allowed AMIs is enabled, the initial describeImages call no
-							// longer returns AMIs that are are not allowed and we/need to use the metadata API call
-							// instead. This metadata uniquely returns the account ID as the ownerAlias which was
-							// messing with the logic
-							if ptr.ToString(instance.ImageMetadata.ImageOwnerAlias) == ptr.ToString(instance.
-								ImageMetadata.OwnerId) {
-								imageOwnerAlias = ""
-							} else {
-								imageOwnerAlias = ptr.ToString(instance.ImageMetadata.ImageOwnerAlias)
-							}
-
-							ami = AMI{
-								ID:          amiID,
-								Region:      region,
-								OwnerAlias:  imageOwnerAlias,
-								OwnerID:     ptr.ToString(instance.ImageMetadata.OwnerId),
-								OwnerName:   ownerName,
-								Name:        ptr.ToString(instance.ImageMetadata.Name),
-								Description: "Unable to find description. AMI has been deleted or made private",
-							}
-						}
-					}
-
-					if ami.OwnerAlias != "" {
-						if ami.OwnerAlias == "amazon" {
-							if verbose {
-								color.Green("[%d/%d][%s] %s is a community AMI from an AWS verified account.", i+1, len(instanceIDs), region, amiID)
-							}
-							verifiedAMIs[amiID] = ami
-						} else if ami.OwnerAlias == "aws-marketplace" {
-							if verbose {
-								color.Green("[%d/%d][%s] %s is a AWS marketplace AMI from a verified account.", i+1, len(instanceIDs), region, amiID)
-							}
-							verifiedAMIs[amiID] = ami
-						} else if ami.OwnerAlias == "self" {
-							if verbose {
-								color.Green("[%d/%d][%s] %s is hosted from this account.", i+1, len(instanceIDs), region, amiID)
-							}
-							selfHostedAMIs[amiID] = ami
-						}
-					} else {
-						// The AMI has no OwnerAlias specified which means it is a community AMI or shared directly with this account.
-
-						// check if the AMI is from an allowed account
-						if allowedAMIsState == "enabled" || allowedAMIsState == "audit-mode" {
-							if contains(allowedAMIAccounts, ami.OwnerID) {
-								if verbose {
-									color.Green("[%d/%d][%s] %s is from an allowed account.", i+1, len(instanceIDs), region, amiID)
-								}
-								alllowedAMIs[amiID] = ami
-								continue // skip the rest of the checks
-							}
-						}
-
-						// check to see if the AMI is from a trusted account that the user has specified
-						if contains(trustedAccounts, ami.OwnerID) {
-							if verbose {
-								color.Green("[%d/%d][%s] %s is from a trusted account.", i+1, len(instanceIDs), region, amiID)
-							}
-							trustedAMIs[amiID] = ami
-							continue
-						}
-
-						// check to see if the AMI is shared privately with this account (but not trusted or allowed)
-						if ami.Public == "Private" {
-							// if the ownerID is the same as the caller identity, then it is self hosted
-							if ami.OwnerID == *callerIdentity.Account {
-								if verbose {
-									color.Green("[%d/%d][%s] %s is hosted from this account.", i+1, len(instanceIDs), region, amiID)
-								}
-								selfHostedAMIs[amiID] = ami
-								continue
-							}
-							if verbose {
-								color.Yellow("[%d/%d][%s] %s is privately shared with me but not from a trusted or allowed account.", i+1, len(instanceIDs), region, amiID)
-							}
-							privateSharedAMIs[amiID] = ami
-							continue
-						}
-						// if the ami.OwnerName is not empty or "unknown" then it is a community AMI
-						if ami.OwnerName != "" && ami.OwnerName != AmiOwnerNameUnknown {
-							if verbose {
-								color.Yellow("[%d/%d][%s] %s is from an unverified account but is a known AWS vendor"+
-									" according to the community.", i+1, len(instanceIDs), region, amiID)
-							}
-							unverifiedButKnownAMIs[amiID] = ami
-							continue
-						}
-						color.Red("[%d/%d][%s] %s is from an unverified account.", i+1, len(instanceIDs), region, amiID)
-
-						unverifiedAMIs[amiID] = ami
-					}
-				}
+	switch {
+	case len(violations) > 0:
+		logger.Error("Failing: " + strings.Join(violations, ", "))
+		return exitFindings
+	case result.Incomplete():
+		var regions, accounts []string
+		for _, region := range result.IncompleteRegions() {
+			regions = append(regions, result.RegionLabel(region))
+		}
+		for _, accountErr := range result.AccountErrors {
+			accounts = append(accounts, accountErr.Account)
+		}
+		logger.Error("Failing: the scan is incomplete", "regions", strings.Join(regions, ","),
+			"accounts", strings.Join(accounts, ","))
+		return exitIncomplete
+	default:
+		return exitOK
+	}
+}
 
-			}
+// countRegionsWithAllowedAMIsDisabled returns the number of scanned regions whose Allowed AMIs state was read and is
+// neither enabled nor audit-mode. A region whose state could not be read has a scan error, which makes the scan
+// incomplete instead.
+func countRegionsWithAllowedAMIsDisabled(result *scanner.Result) int {
+	var disabled int
+	for _, region := range result.Regions {
+		switch result.AllowedAMIStateByRegion[region] {
+		case "enabled", "audit-mode", "":
+		default:
+			disabled++
 		}
 	}
+	return disabled
+}
 
+// printSummary prints the summary key, the count of AMIs in each category and the instances launched from AMIs
+// that are not trusted.
+func printSummary(result *scanner.Result) {
 	var enabledCount, auditModeCount, disabledCount int
-	if !allowedAMIPermissionDenied {
-		enabledCount, auditModeCount, disabledCount = countRegionsWithAllowedAmisEnabled(regions, allowedAMIStateByRegion)
+	if !result.AllowedAMIPermissionDenied {
+		enabledCount, auditModeCount, disabledCount = result.CountRegionsWithAllowedAmisEnabled()
 	}
 
 	// Print a summary key before the summary that defines the terms:
-	fmt.Println("\nSummary Key:")
-	fmt.Println("+-------------------------------+-----------------------------------------------------------+")
-	fmt.Println("| Term                          | Definition                                                |")
-	fmt.Println("+-------------------------------+-----------------------------------------------------------+")
+	fmt.Fprintln(color.Output, "\nSummary Key:")
+	fmt.Fprintln(color.Output, "+-------------------------------+-----------------------------------------------------------+")
+	fmt.Fprintln(color.Output, "| Term                          | Definition                                                |")
+	fmt.Fprintln(color.Output, "+-------------------------------+-----------------------------------------------------------+")
 	color.Green("| Self hosted                   | AMIs from this account                                    |")
 	color.Green("| Allowed AMIs                  | AMIs from an allowed account per the AWS Allowed AMIs API |")
 	color.Green("| Trusted AMIs                  | AMIs from an trusted account per user input to this tool  |")
@@ -438,6 +431,7 @@ func main() {
 	color.Yellow("|                               | verified, trusted or allowed account. If you trust this   |")
 	color.Yellow("|                               | account, add it to your Allowed AMIs API or specify it as |")
 	color.Yellow("|                               | trusted in the whoAMI-scanner command line.               |")
+	color.Yellow("| Unknown                       | AMIs with an owner alias this tool does not recognize     |")
 	color.Yellow("| Public, unverified, but known | AMIs from unverified accounts, but we found the account   |")
 	color.Yellow("|                               | ID in fwdcloudsec's known_aws_accounts mapping:           |")
 	color.Yellow("|                               |   https://github.com/fwdcloudsec/known_aws_accounts.      |")
@@ -446,129 +440,213 @@ func main() {
 	color.Red("|                               | unless they are from accounts you control. If not from    |")
 	color.Red("|                               | your accounts, look to replace these with AMIs from       |")
 	color.Red("|                               | verified accounts                                         |")
-	fmt.Println("+-------------------------------+-----------------------------------------------------------+")
+	fmt.Fprintln(color.Output, "+-------------------------------+-----------------------------------------------------------+")
 
 	// Output results
-	fmt.Println("\nSummary:")
+	fmt.Fprintln(color.Output, "\nSummary:")
 
-	if allowedAMIPermissionDenied {
+	if result.AllowedAMIPermissionDenied {
 		color.Cyan("    AWS's \"Allowed AMI\" config status unknown (permission denied)")
 	} else {
 		color.Cyan(" AWS's \"Allowed AMI\" config status by region")
 		color.Cyan("                 Enabled/Audit-mode/Disabled: %d/%d/%d", enabledCount, auditModeCount, disabledCount)
 	}
-	color.Cyan("                             Total Instances: %d", totalInstances)
-	color.Cyan("                                  Total AMIs: %d", len(processedAMIs))
-	color.Green("                            Self hosted AMIs: %d", len(selfHostedAMIs))
-	color.Green("                                Allowed AMIs: %d", len(alllowedAMIs))
-	color.Green("                                Trusted AMIs: %d", len(trustedAMIs))
-	color.Green("                               Verified AMIs: %d", len(verifiedAMIs))
-	color.Yellow("               Shared with me (Private) AMIs: %d", len(privateSharedAMIs))
-	color.Yellow("               Public, unverified, but known: %d", len(unverifiedButKnownAMIs))
-	color.Red("          Public, unverified, & unknown AMIs: %d", len(unverifiedAMIs))
-
-	if len(privateSharedAMIs) > 0 {
+	if result.MultiAccount() {
+		color.Cyan("                            Scanned accounts: %d", len(result.Accounts))
+	}
+	color.Cyan("                             Total Instances: %d", result.TotalInstances)
+	color.Cyan("                                  Total AMIs: %d", len(result.ProcessedAMIs))
+	color.Green("                            Self hosted AMIs: %d", len(result.SelfHostedAMIs))
+	color.Green("                                Allowed AMIs: %d", len(result.AllowedAMIs))
+	color.Green("                                Trusted AMIs: %d", len(result.TrustedAMIs))
+	color.Green("                               Verified AMIs: %d", len(result.VerifiedAMIs))
+	color.Yellow("               Shared with me (Private) AMIs: %d", len(result.PrivateSharedAMIs))
+	color.Yellow("                                Unknown AMIs: %d", len(result.UnknownAMIs))
+	color.Yellow("               Public, unverified, but known: %d", len(result.UnverifiedButKnownAMIs))
+	color.Red("          Public, unverified, & unknown AMIs: %d", len(result.UnverifiedAMIs))
+	if len(result.Errors) > 0 {
+		color.Red("                          Incomplete regions: %d", len(result.IncompleteRegions()))
+	}
+	if len(result.AccountErrors) > 0 {
+		color.Red("                       Accounts not scanned: %d", len(result.AccountErrors))
+	}
+
+	// The maps are iterated in random order, so the instances are listed in the order of the sorted AMIs
+	amis := result.AMIs()
+	if len(result.PrivateSharedAMIs) > 0 {
 		color.Yellow("\nInstances created with privately shared AMIs:")
-		for amiID := range privateSharedAMIs {
-			for _, instance := range amiToInstanceMap[amiID] {
-				fmt.Printf(" %s | %s | %s | Account: %s | Vendor Name: %s | Instance Name: %s | AMI Name: %s\n", amiID,
-					instance.Region, instance.ID, privateSharedAMIs[amiID].OwnerID,
-					privateSharedAMIs[amiID].OwnerName, instance.Name, privateSharedAMIs[amiID].Name)
+		for _, ami := range amis {
+			if ami.Status != scanner.StatusPrivateShared {
+				continue
+			}
+			for _, instance := range result.AMIToInstances[ami.Key()] {
+				fmt.Fprintf(color.Output, " %s | %s | %s | Account: %s | Vendor Name: %s | Instance Name: %s | AMI Name: %s\n", ami.ID,
+					result.RegionLabel(ami.RegionKey()), instance.ID, ami.OwnerID,
+					ami.OwnerName, instance.Name, ami.Name)
 			}
 		}
 	}
 
-	if len(unknownAMIs) > 0 {
-		color.Yellow("\nInstances created with unknown AMIs:")
-		for amiID := range unknownAMIs {
-			for _, instance := range amiToInstanceMap[amiID] {
-				fmt.Printf(" %s | %s | %s | Account: %s | Name: %s\n", amiID, instance.Region, instance.ID, unknownAMIs[amiID].OwnerID, instance.Name)
+	if len(result.UnknownAMIs) > 0 {
+		color.Yellow("\nInstances created with AMIs whose owner alias is not recognized:")
+		for _, ami := range amis {
+			if ami.Status != scanner.StatusUnknown {
+				continue
+			}
+			for _, instance := range result.AMIToInstances[ami.Key()] {
+				fmt.Fprintf(color.Output, " %s | %s | %s | Account: %s | Owner Alias: %s | Instance Name: %s | AMI Name: %s\n", ami.ID,
+					result.RegionLabel(ami.RegionKey()), instance.ID, ami.OwnerID,
+					ami.OwnerAlias, instance.Name, ami.Name)
 			}
 		}
 	}
 
-	if len(unverifiedButKnownAMIs) > 0 {
+	if len(result.UnverifiedButKnownAMIs) > 0 {
 		color.Yellow("\nInstances created with AMIs from public unverified accounts but where account belongs to a" +
 			" known vendor:")
-		for amiID := range unverifiedButKnownAMIs {
-			for _, instance := range amiToInstanceMap[amiID] {
-				fmt.Printf(" %s | %s | %s | Account: %s | Vendor Name: %s | Instance Name: %s | AMI Name: %s\n", amiID,
-					instance.Region,
+		for _, ami := range amis {
+			if ami.Status != scanner.StatusUnverifiedButKnown {
+				continue
+			}
+			for _, instance := range result.AMIToInstances[ami.Key()] {
+				fmt.Fprintf(color.Output, " %s | %s | %s | Account: %s | Vendor Name: %s | Instance Name: %s | AMI Name: %s\n", ami.ID,
+					result.RegionLabel(ami.RegionKey()),
 					instance.ID,
-					unverifiedButKnownAMIs[amiID].OwnerID, unverifiedButKnownAMIs[amiID].OwnerName, instance.Name,
-					unverifiedButKnownAMIs[amiID].Name)
+					ami.OwnerID, ami.OwnerName, instance.Name,
+					ami.Name)
 			}
 		}
 
 	}
 
-	if len(unverifiedAMIs) > 0 {
+	if len(result.UnverifiedAMIs) > 0 {
 		color.Red("\nInstances created with AMIs from public unverified accounts:")
-		for amiID := range unverifiedAMIs {
-			for _, instance := range amiToInstanceMap[amiID] {
-				fmt.Printf(" %s | %s | %s | Account: %s | Vendor Name: Unknown | Instance Name: %s | AMI Name: %s"+
-					"\n", amiID,
-					instance.Region,
+		for _, ami := range amis {
+			if ami.Status != scanner.StatusUnverified {
+				continue
+			}
+			for _, instance := range result.AMIToInstances[ami.Key()] {
+				fmt.Fprintf(color.Output, " %s | %s | %s | Account: %s | Vendor Name: Unknown | Instance Name: %s | AMI Name: %s"+
+					"\n", ami.ID,
+					result.RegionLabel(ami.RegionKey()),
 					instance.ID,
-					unverifiedAMIs[amiID].OwnerID, instance.Name, unverifiedAMIs[amiID].Name)
+					ami.OwnerID, instance.Name, ami.Name)
 			}
 		}
 	}
 
-	if output != "" {
-
-		file, err := os.Create(output)
-		if err != nil {
-			color.Red("Error creating output file: %v", err)
-			os.Exit(1)
+	if result.Incomplete() {
+		color.Red("\n[!] The scan is INCOMPLETE. These failures mean instances and AMIs may be missing from the results:")
+		for _, accountErr := range result.AccountErrors {
+			color.Red(" %v", accountErr)
+		}
+		// AMIs whose details could not be looked up may still have been classified from instance metadata
+		classified := make(map[scanner.AMIKey]bool)
+		for _, ami := range amis {
+			classified[ami.Key()] = true
+		}
+		for _, scanErr := range result.Errors {
+			color.Red(" %v", scanErr)
+			for _, amiID := range scanErr.Resources {
+				key := scanner.AMIKey{Account: scanErr.Account, Region: scanErr.Region, ID: amiID}
+				if classified[key] {
+					continue
+				}
+				for _, instance := range result.AMIToInstances[key] {
+					fmt.Fprintf(color.Output, " %s | %s | %s | Instance Name: %s | not classified\n", amiID,
+						result.RegionLabel(scanErr.RegionKey()),
+						instance.ID, instance.Name)
+				}
+			}
 		}
-		defer file.Close()
+	}
+}
 
-		_, err = file.WriteString("AMI ID|Region|whoAMI status|Public|Owner Alias|Owner ID|Vendor Name|Name" +
-			"|Description\n")
-		for _, ami := range verifiedAMIs {
-			_, err = file.WriteString(fmt.Sprintf("%s|%s|Verified|%s|%s|%s|%s|%s|%s\n", ami.ID, ami.Region, ami.Public,
-				ami.OwnerAlias, ami.OwnerID, ami.OwnerName, ami.Name, ami.Description))
-		}
-		for _, ami := range selfHostedAMIs {
-			_, err = file.WriteString(fmt.Sprintf("%s|%s|Self hosted|%s|%s|%s|%s|%s|%s\n", ami.ID, ami.Region,
-				ami.Public, ami.OwnerAlias, ami.OwnerID, ami.OwnerName, ami.Name, ami.Description))
-		}
-		for _, ami := range alllowedAMIs {
-			_, err = file.WriteString(fmt.Sprintf("%s|%s|Allowed|%s|%s|%s|%s|%s|%s\n", ami.ID, ami.Region, ami.Public,
-				ami.OwnerAlias, ami.OwnerID, ami.OwnerName, ami.Name, ami.Description))
-		}
-		for _, ami := range trustedAMIs {
-			_, err = file.WriteString(fmt.Sprintf("%s|%s|Trusted|%s|%s|%s|%s|%s|%s\n", ami.ID, ami.Region, ami.Public,
-				ami.OwnerAlias, ami.OwnerID, ami.OwnerName, ami.Name, ami.Description))
-		}
-		for _, ami := range privateSharedAMIs {
-			_, err = file.WriteString(fmt.Sprintf("%s|%s|Private Shared|%s|%s|%s|%s|%s|%s\n", ami.ID, ami.Region,
-				ami.Public, ami.OwnerAlias, ami.OwnerID, ami.OwnerName, ami.Name, ami.Description))
-		}
-		for _, ami := range unverifiedButKnownAMIs {
-			_, err = file.WriteString(fmt.Sprintf("%s|%s|Unverified but known|%s|%s|%s|%s|%s|%s\n", ami.ID, ami.Region,
-				ami.Public, ami.OwnerAlias, ami.OwnerID, ami.Name, ami.OwnerName, ami.Description))
-		}
-		for _, ami := range unverifiedAMIs {
-			_, err = file.WriteString(fmt.Sprintf("%s|%s|Unverified|%s|%s|%s|%s|%s|%s\n", ami.ID, ami.Region,
-				ami.Public, ami.OwnerAlias, ami.OwnerID, ami.OwnerName, ami.Name, ami.Description))
+// reportTarget is a report to write, given as format=path with --report.
+type reportTarget struct {
+	format string
+	path   string
+}
+
+// reportTargets implements flag.Value for the repeatable --report flag.
+type reportTargets []reportTarget
+
+func (r *reportTargets) String() string {
+	var targets []string
+	for _, target := range *r {
+		targets = append(targets, target.format+"="+target.path)
+	}
+	return strings.Join(targets, ",")
+}
+
+func (r *reportTargets) Set(value string) error {
+	format, path, ok := strings.Cut(value, "=")
+	if !ok || path == "" {
+		return fmt.Errorf("%q is not of the form format=path", value)
+	}
+	if !slices.Contains(report.Formats(), format) {
+		return fmt.Errorf("unknown report format %q (supported formats: %s)", format, strings.Join(report.Formats(), ", "))
+	}
+	*r = append(*r, reportTarget{format: format, path: path})
+	return nil
+}
+
+// errDuplicateReportPath is returned by reportTargets.prepare when two reports would overwrite each other.
+var errDuplicateReportPath = errors.New("more than one report is written to the same path")
+
+// prepare makes the path of every report absolute and creates its directories, so a bad path fails before the scan.
+func (r reportTargets) prepare() error {
+	seenPaths := make(map[string]bool)
+	for i, target := range r {
+		fullPath := stdoutPath
+		if target.path != stdoutPath {
+			var err error
+			fullPath, err = PreparePath(target.path)
+			if err != nil {
+				return err
+			}
 		}
-		// let the user know the file was written, but give them the full path. If the user have a full path print that, if they just gave a file name, print the full path using hte current direcotry
-		// this is to make it easier for the user to know where the file was written
-		if output[0] == '/' {
-			color.Green("Output written to %s", output)
-		} else {
-			wd, _ := os.Getwd()
-			color.Green("Output written to %s/%s", wd, output)
+		if seenPaths[fullPath] {
+			return fmt.Errorf("%w: %s", errDuplicateReportPath, fullPath)
 		}
+		seenPaths[fullPath] = true
+		r[i].path = fullPath
+	}
+	return nil
+}
+
+// stdoutPath is the report path that writes the report to stdout.
+const stdoutPath = "-"
+
+// writeReport renders the scan result in the given format to outputPath, or to stdout if outputPath is stdoutPath.
+func writeReport(outputPath, format string, result *scanner.Result, opts report.Options) error {
+	if outputPath == stdoutPath {
+		return report.Write(format, os.Stdout, result, opts)
+	}
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	if err := report.Write(format, file, result, opts); err != nil {
+		file.Close()
+		return err
+	}
+	// A write that only fails when the file is flushed, for instance on a full disk, is reported by Close
+	return file.Close()
+}
+
+// printAllowedAMIsHint points the user at AWS's Allowed AMIs documentation unless every region enforces it.
+func printAllowedAMIsHint(result *scanner.Result) {
+	var enabledCount, auditModeCount int
+	if !result.AllowedAMIPermissionDenied {
+		enabledCount, auditModeCount, _ = result.CountRegionsWithAllowedAmisEnabled()
 	}
 	// Unless all regions are enabled or in audit mode, print a message telling the user to visit https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/ec2-allowed-amis.html
 	if enabledCount+auditModeCount == 0 {
 		color.Red("\n[!] No regions have AWS's \"Allowed AMIs\" feature enabled or in audit mode.")
 		color.Red("\tEnabling Allowed AMIs protects you against the whoAMI attack.")
 		color.Red("\tVisit https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/ec2-allowed-amis.html for more information.")
-	} else if enabledCount < len(regions) {
+	} else if enabledCount < len(result.Regions) {
 		color.Yellow("\n[!] Looks like you have started to use AWS's \"Allowed AMIs\" feature.")
 		color.Yellow("\tOnly configuring \"Allowed AMIs\" in \"enabled\" mode protects you against the whoAMI attack.")
 		color.Yellow("\tVisit https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/ec2-allowed-amis.html for more information.")
@@ -581,7 +659,7 @@ func PreparePath(outputPath string) (string, error) {
 
 	// Determine if the path is absolute, relative, or just a file name
 	if filepath.IsAbs(outputPath) {
-		fullPath = outputPath
+		fullPath = filepath.Clean(outputPath)
 	} else if strings.Contains(outputPath, string(os.PathSeparator)) {
 		// It's a relative path
 		absPath, err := filepath.Abs(outputPath)
@@ -607,137 +685,74 @@ func PreparePath(outputPath string) (string, error) {
 	return fullPath, nil
 }
 
-func CheckAllowedAMIs(client *ec2.Client) (string, []string, error) {
-	// Check if the region supports allowedAMIs
-	GetAllowedImagesOutput, err := client.GetAllowedImagesSettings(context.TODO(), &ec2.GetAllowedImagesSettingsInput{})
-
-	if err != nil {
-		return "", nil, fmt.Errorf("failed to get allowed AMIs settings: %v", err)
-
-	}
-	var ImageCriteria []types.ImageCriterion
-	var ImageProviders []string
-
-	ImageCriteria = GetAllowedImagesOutput.ImageCriteria
-	for _, ImageCriteria := range ImageCriteria {
-		ImageProviders = append(ImageProviders, ImageCriteria.ImageProviders...)
-	}
-
-	return *GetAllowedImagesOutput.State, ImageProviders, nil
-}
-
-// Returns true of a string is in the given list of strings. Else false
-func contains(slice []string, item string) bool {
-	for _, a := range slice {
-		if a == item {
-			return true
-		}
-	}
-	return false
-}
+// loadAWSConfig provides enhanced credential loading with Windows-specific debugging
+func loadAWSConfig(profile string, retryMode aws.RetryMode, maxAttempts int) (aws.Config, error) {
+	logger.Debug("Loading AWS config", "profile", profile, "os", runtime.GOOS, "arch", runtime.GOARCH)
 
-func countRegionsWithAllowedAmisEnabled(regions []string, allowedAMIStateByRegion map[string]string) (int, int, int) {
-	var enabledCount, auditModeCount, disabledCount int
-	for _, region := range regions {
-		switch allowedAMIStateByRegion[region] {
-		case "enabled":
-			enabledCount++
-		case "audit-mode":
-			auditModeCount++
-		default:
-			disabledCount++
-		}
+	// Check for environment variables
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+		logger.Debug("Checked AWS environment variable", "name", name, "found", os.Getenv(name) != "")
 	}
-	return enabledCount, auditModeCount, disabledCount
-}
 
-// loadAWSConfig provides enhanced credential loading with Windows-specific debugging
-func loadAWSConfig(profile string, verbose bool) (aws.Config, error) {
-	if verbose {
-		fmt.Printf("[DEBUG] Loading AWS config for profile: %s\n", profile)
-		fmt.Printf("[DEBUG] Operating system: %s\n", runtime.GOOS)
-		fmt.Printf("[DEBUG] Architecture: %s\n", runtime.GOARCH)
-		
-		// Check for environment variables
-		if os.Getenv("AWS_ACCESS_KEY_ID") != "" {
-			fmt.Printf("[DEBUG] Found AWS_ACCESS_KEY_ID environment variable\n")
-		} else {
-			fmt.Printf("[DEBUG] No AWS_ACCESS_KEY_ID environment variable found\n")
-		}
-		
-		if os.Getenv("AWS_SECRET_ACCESS_KEY") != "" {
-			fmt.Printf("[DEBUG] Found AWS_SECRET_ACCESS_KEY environment variable\n")
-		} else {
-			fmt.Printf("[DEBUG] No AWS_SECRET_ACCESS_KEY environment variable found\n")
-		}
-		
-		if os.Getenv("AWS_SESSION_TOKEN") != "" {
-			fmt.Printf("[DEBUG] Found AWS_SESSION_TOKEN environment variable\n")
-		} else {
-			fmt.Printf("[DEBUG] No AWS_SESSION_TOKEN environment variable found\n")
-		}
-		
-		// Check AWS credentials file location
-		homeDir, err := os.UserHomeDir()
-		if err == nil {
-			awsDir := filepath.Join(homeDir, ".aws")
-			credentialsFile := filepath.Join(awsDir, "credentials")
-			configFile := filepath.Join(awsDir, "config")
-			
-			if _, err := os.Stat(credentialsFile); err == nil {
-				fmt.Printf("[DEBUG] Found AWS credentials file: %s\n", credentialsFile)
-			} else {
-				fmt.Printf("[DEBUG] AWS credentials file not found: %s\n", credentialsFile)
-			}
-			
-			if _, err := os.Stat(configFile); err == nil {
-				fmt.Printf("[DEBUG] Found AWS config file: %s\n", configFile)
-			} else {
-				fmt.Printf("[DEBUG] AWS config file not found: %s\n", configFile)
-			}
+	// Check AWS credentials file location
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		awsDir := filepath.Join(homeDir, ".aws")
+		for _, file := range []string{filepath.Join(awsDir, "credentials"), filepath.Join(awsDir, "config")} {
+			_, err := os.Stat(file)
+			logger.Debug("Checked AWS shared config file", "path", file, "found", err == nil)
 		}
 	}
 
-	// Try to load config with the specified profile
-	var cfg aws.Config
-	var err error
-	
 	// Build config options
 	configOptions := []func(*config.LoadOptions) error{
 		config.WithRegion("us-east-1"),
+		config.WithRetryer(func() aws.Retryer {
+			return newRetryer(retryMode, maxAttempts)
+		}),
 	}
-	
+
 	if profile != "" {
 		configOptions = append(configOptions, config.WithSharedConfigProfile(profile))
 	}
-	
+
 	// On Windows, try to be more explicit about credential providers
-	if runtime.GOOS == "windows" && verbose {
-		fmt.Printf("[DEBUG] Using Windows-specific credential loading strategy\n")
+	if runtime.GOOS == "windows" {
+		logger.Debug("Using Windows-specific credential loading strategy")
 	}
-	
-	cfg, err = config.LoadDefaultConfig(context.TODO(), configOptions...)
-	
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), configOptions...)
 	if err != nil {
-		if verbose {
-			fmt.Printf("[DEBUG] Failed to load AWS config: %v\n", err)
-			
-			// On Windows, provide specific guidance
-			if runtime.GOOS == "windows" {
-				fmt.Printf("[DEBUG] Windows-specific credential troubleshooting:\n")
-				fmt.Printf("[DEBUG] 1. Ensure AWS CLI is properly configured: aws configure\n")
-				fmt.Printf("[DEBUG] 2. Check Windows Credential Manager for stored AWS credentials\n")
-				fmt.Printf("[DEBUG] 3. Try setting environment variables explicitly\n")
-				fmt.Printf("[DEBUG] 4. Verify the AWS credentials file is in %%USERPROFILE%%\\.aws\\credentials\n")
-				fmt.Printf("[DEBUG] 5. Try running: aws sts get-caller-identity to test CLI credentials\n")
-			}
+		logger.Debug("Failed to load AWS config", "error", err)
+
+		// On Windows, provide specific guidance
+		if runtime.GOOS == "windows" {
+			logger.Debug("Windows-specific credential troubleshooting:")
+			logger.Debug("1. Ensure AWS CLI is properly configured: aws configure")
+			logger.Debug("2. Check Windows Credential Manager for stored AWS credentials")
+			logger.Debug("3. Try setting environment variables explicitly")
+			logger.Debug("4. Verify the AWS credentials file is in %USERPROFILE%\\.aws\\credentials")
+			logger.Debug("5. Try running: aws sts get-caller-identity to test CLI credentials")
 		}
 		return cfg, err
 	}
-	
-	if verbose {
-		fmt.Printf("[DEBUG] Successfully loaded AWS config\n")
-	}
-	
+
+	logger.Debug("Successfully loaded AWS config")
 	return cfg, nil
 }
+
+// newRetryer returns the retryer used for every AWS API call. In adaptive mode, throttling errors such as
+// RequestLimitExceeded also slow down the rate at which the client sends requests.
+func newRetryer(mode aws.RetryMode, maxAttempts int) aws.Retryer {
+	standardOptions := func(o *retry.StandardOptions) {
+		o.MaxAttempts = maxAttempts
+		// A scan of a large account is throttled often enough to drain the default retry quota, after which calls
+		// fail without being retried at all
+		o.RateLimiter = ratelimit.None
+	}
+	if mode == aws.RetryModeAdaptive {
+		return retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, standardOptions)
+		})
+	}
+	return retry.NewStandard(standardOptions)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/whoAMI-scanner/report"
+	"github.com/DataDog/whoAMI-scanner/scanner"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+)
+
+const testAccount = "111111111111"
+
+// TestInvalidFlags runs the scanner in a child process, as main exits, and checks that invalid flag values exit with
+// the usage code before anything is sent to AWS.
+func TestInvalidFlags(t *testing.T) {
+	if args := os.Getenv("WHOAMI_SCANNER_TEST_ARGS"); args != "" {
+		os.Args = append([]string{"whoAMI-scanner"}, strings.Fields(args)...)
+		main()
+		return
+	}
+
+	tests := []struct {
+		name string
+		args string
+		want string
+	}{
+		{"unknown log format", "--log-format bogus", "Invalid --log-format"},
+		{"unknown log level", "--log-level loud", "Invalid --log-level"},
+		{"zero max attempts", "--max-attempts 0", "Invalid --max-attempts"},
+		{"zero Markdown length", "--markdown-max-length 0", "Invalid --markdown-max-length"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestInvalidFlags$")
+			cmd.Env = append(os.Environ(), "WHOAMI_SCANNER_TEST_ARGS="+tt.args)
+			out, err := cmd.CombinedOutput()
+			var exitErr *exec.ExitError
+			// A panic also exits with 2, so the logged error is checked too
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != exitUsage || !strings.Contains(string(out), tt.want) {
+				t.Errorf("whoAMI-scanner %s exited with %v, want %d and %q\n%s", tt.args, err, exitUsage, tt.want, out)
+			}
+		})
+	}
+}
+
+func TestParseStatuses(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []scanner.Status
+		wantErr string
+	}{
+		{input: ""},
+		{input: "unverified, private-shared,", want: []scanner.Status{scanner.StatusUnverified, scanner.StatusPrivateShared}},
+		{input: "unverified,untrusted", wantErr: `unknown whoAMI status "untrusted"`},
+		{input: "Unverified", wantErr: `unknown whoAMI status "Unverified"`},
+		{input: "unknown", want: []scanner.Status{scanner.StatusUnknown}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseStatuses(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseStatuses() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseStatuses() error = %v", err)
+			}
+			want := make(map[scanner.Status]bool)
+			for _, status := range tt.want {
+				want[status] = true
+			}
+			if !maps.Equal(got, want) {
+				t.Errorf("parseStatuses() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	usEast := scanner.RegionKey{Account: testAccount, Region: "us-east-1"}
+	euWest := scanner.RegionKey{Account: testAccount, Region: "eu-west-1"}
+	// newResult returns the result of a scan of two regions, with one unverified AMI in use when unverified is set
+	newResult := func(usEastState, euWestState string, unverified bool) *scanner.Result {
+		result := &scanner.Result{
+			Identity:                scanner.Identity{Account: testAccount},
+			Accounts:                []string{testAccount},
+			Regions:                 []scanner.RegionKey{usEast, euWest},
+			AllowedAMIStateByRegion: map[scanner.RegionKey]string{usEast: usEastState, euWest: euWestState},
+			UnverifiedAMIs:          make(map[scanner.AMIKey]scanner.AMI),
+		}
+		if unverified {
+			ami := scanner.AMI{ID: "ami-1", Account: testAccount, Region: "us-east-1", Status: scanner.StatusUnverified}
+			result.UnverifiedAMIs[ami.Key()] = ami
+		}
+		return result
+	}
+	incomplete := func(result *scanner.Result) *scanner.Result {
+		result.Errors = []scanner.ScanError{{Account: testAccount, Region: "eu-west-1", Operation: "DescribeInstances",
+			Err: errors.New("RequestLimitExceeded")}}
+		return result
+	}
+	unreadable := func(result *scanner.Result) *scanner.Result {
+		result.Errors = []scanner.ScanError{{Account: testAccount, Region: "eu-west-1", Operation: "GetAllowedImagesSettings",
+			Err: errors.New("RequestLimitExceeded")}}
+		return result
+	}
+	permissionDenied := func(result *scanner.Result) *scanner.Result {
+		result.AllowedAMIPermissionDenied = true
+		return result
+	}
+
+	tests := []struct {
+		name                      string
+		result                    *scanner.Result
+		failOn                    []scanner.Status
+		failIfAllowedAMIsDisabled bool
+		want                      int
+	}{
+		{"clean scan", newResult("enabled", "enabled", false), nil, false, exitOK},
+		{"findings without --fail-on", newResult("enabled", "enabled", true), nil, false, exitOK},
+		{"finding matches --fail-on", newResult("enabled", "enabled", true), []scanner.Status{scanner.StatusUnverified}, false, exitFindings},
+		{"finding does not match --fail-on", newResult("enabled", "enabled", true), []scanner.Status{scanner.StatusPrivateShared}, false, exitOK},
+		{"incomplete scan", incomplete(newResult("enabled", "enabled", false)), nil, false, exitIncomplete},
+		{
+			"failed account",
+			&scanner.Result{AccountErrors: []scanner.AccountError{{Account: "222222222222", Err: errors.New("AccessDenied")}}},
+			nil, false, exitIncomplete,
+		},
+		{"findings take precedence over an incomplete scan", incomplete(newResult("enabled", "enabled", true)),
+			[]scanner.Status{scanner.StatusUnverified}, false, exitFindings},
+		{"Allowed AMIs disabled in a region", newResult("enabled", "disabled", false), nil, true, exitFindings},
+		{"Allowed AMIs in audit mode", newResult("audit-mode", "enabled", false), nil, true, exitOK},
+		{"Allowed AMIs disabled without the flag", newResult("disabled", "disabled", false), nil, false, exitOK},
+		{"Allowed AMIs state permission denied", permissionDenied(newResult("", "", false)), nil, true, exitFindings},
+		{"Allowed AMIs state permission denied without the flag", permissionDenied(newResult("", "", false)), nil, false, exitOK},
+		{"Allowed AMIs state unreadable in a region", unreadable(newResult("enabled", "", false)), nil, true, exitIncomplete},
+		{"disabled Allowed AMIs takes precedence over an incomplete scan", incomplete(newResult("disabled", "enabled", false)),
+			nil, true, exitFindings},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failOn := make(map[scanner.Status]bool)
+			for _, status := range tt.failOn {
+				failOn[status] = true
+			}
+			if got := exitCode(tt.result, failOn, tt.failIfAllowedAMIsDisabled); got != tt.want {
+				t.Errorf("exitCode() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReportTargets(t *testing.T) {
+	dir := t.TempDir()
+	parse := func(args ...string) (reportTargets, error) {
+		var reports reportTargets
+		flags := flag.NewFlagSet("whoAMI-scanner", flag.ContinueOnError)
+		flags.SetOutput(io.Discard)
+		flags.Var(&reports, "report", "")
+		return reports, flags.Parse(args)
+	}
+
+	reports, err := parse("--report", "json="+filepath.Join(dir, "out", "scan.json"), "--report", "sarif=-",
+		"--report", "csv=a=b.csv")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := reportTargets{
+		{format: "json", path: filepath.Join(dir, "out", "scan.json")},
+		{format: "sarif", path: stdoutPath},
+		{format: "csv", path: "a=b.csv"},
+	}
+	if !slices.Equal(reports, want) {
+		t.Errorf("reports = %v, want %v", reports, want)
+	}
+
+	for _, value := range []string{"json", "json=", "=scan.json", "yaml=scan.yaml"} {
+		if _, err := parse("--report", value); err == nil {
+			t.Errorf("Parse(--report %s) succeeded, want an error", value)
+		}
+	}
+
+	reports, err = parse("--report", "json="+filepath.Join(dir, "out", "scan.json"), "--report", "sarif=-")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if err := reports.prepare(); err != nil {
+		t.Fatalf("prepare() error = %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "out")); err != nil || !info.IsDir() {
+		t.Errorf("prepare() did not create the report directory: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"--report", "json=" + filepath.Join(dir, "scan.out"), "--report", "csv=" + filepath.Join(dir, "out", "..", "scan.out")},
+		{"--report", "json=-", "--report", "sarif=-"},
+	} {
+		reports, err := parse(args...)
+		if err != nil {
+			t.Fatalf("Parse() error = %v", err)
+		}
+		if err := reports.prepare(); !errors.Is(err, errDuplicateReportPath) {
+			t.Errorf("prepare(%v) error = %v, want errDuplicateReportPath", args, err)
+		}
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.json")
+	result := &scanner.Result{Identity: scanner.Identity{Account: testAccount}, Accounts: []string{testAccount}}
+	if err := writeReport(path, "json", result, report.Options{ToolVersion: "1.2.3"}); err != nil {
+		t.Fatalf("writeReport() error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Complete bool `json:"complete"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil || !got.Complete {
+		t.Errorf("report = %s, want a complete JSON report (error %v)", data, err)
+	}
+
+	if err := writeReport(filepath.Join(t.TempDir(), "missing", "scan.json"), "json", result, report.Options{}); err == nil {
+		t.Error("writeReport() to a missing directory succeeded, want an error")
+	}
+}
+
+func TestNewRetryer(t *testing.T) {
+	tests := []struct {
+		mode        aws.RetryMode
+		maxAttempts int
+	}{
+		{aws.RetryModeStandard, 1},
+		{aws.RetryModeStandard, 10},
+		{aws.RetryModeAdaptive, 3},
+		{aws.RetryModeAdaptive, 10},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.mode, tt.maxAttempts), func(t *testing.T) {
+			retryer := newRetryer(tt.mode, tt.maxAttempts)
+			if got := retryer.MaxAttempts(); got != tt.maxAttempts {
+				t.Errorf("MaxAttempts() = %d, want %d", got, tt.maxAttempts)
+			}
+			if _, adaptive := retryer.(*retry.AdaptiveMode); adaptive != (tt.mode == aws.RetryModeAdaptive) {
+				t.Errorf("newRetryer(%s) returned a %T", tt.mode, retryer)
+			}
+			// The default retry quota runs out after a few hundred throttled calls, which would stop retries altogether
+			for i := 0; i < 1000; i++ {
+				if _, err := retryer.GetRetryToken(context.Background(), errors.New("RequestLimitExceeded")); err != nil {
+					t.Fatalf("GetRetryToken() error = %v after %d retries", err, i)
+				}
+			}
+		})
+	}
+}
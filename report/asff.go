@@ -0,0 +1,178 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+const (
+	asffSchemaVersion = "2018-10-08"
+	// asffGeneratorPrefix starts the GeneratorId of every finding, so findings from earlier scans can be looked up
+	asffGeneratorPrefix = "whoami-scanner/"
+	// DefaultSecurityHubRegion is the Security Hub region findings are imported into when none is configured.
+	DefaultSecurityHubRegion = "us-east-1"
+)
+
+// asffSeverity maps the statuses reported to Security Hub to a severity label, following the colour of the status
+// in the summary key: red is high and yellow medium.
+var asffSeverity = map[scanner.Status]string{
+	scanner.StatusPrivateShared:      "MEDIUM",
+	scanner.StatusUnknown:            "MEDIUM",
+	scanner.StatusUnverifiedButKnown: "MEDIUM",
+	scanner.StatusUnverified:         "HIGH",
+}
+
+// ASFFFinding is a finding in the AWS Security Finding Format. Only the fields set by whoAMI-scanner are defined.
+type ASFFFinding struct {
+	SchemaVersion string            `json:"SchemaVersion"`
+	Id            string            `json:"Id"`
+	ProductArn    string            `json:"ProductArn"`
+	GeneratorId   string            `json:"GeneratorId"`
+	AwsAccountId  string            `json:"AwsAccountId"`
+	Types         []string          `json:"Types"`
+	CreatedAt     string            `json:"CreatedAt"`
+	UpdatedAt     string            `json:"UpdatedAt"`
+	Severity      ASFFSeverity      `json:"Severity"`
+	Title         string            `json:"Title"`
+	Description   string            `json:"Description"`
+	SourceUrl     string            `json:"SourceUrl,omitempty"`
+	ProductFields map[string]string `json:"ProductFields,omitempty"`
+	Resources     []ASFFResource    `json:"Resources"`
+	RecordState   string            `json:"RecordState"`
+	Workflow      ASFFWorkflow      `json:"Workflow"`
+}
+
+type ASFFSeverity struct {
+	Label string `json:"Label"`
+}
+
+type ASFFResource struct {
+	Type      string            `json:"Type"`
+	Id        string            `json:"Id"`
+	Partition string            `json:"Partition"`
+	Region    string            `json:"Region"`
+	Details   *ASFFDetails      `json:"Details,omitempty"`
+	Tags      map[string]string `json:"Tags,omitempty"`
+}
+
+type ASFFDetails struct {
+	AwsEc2Instance *ASFFInstanceDetails `json:"AwsEc2Instance,omitempty"`
+	Other          map[string]string    `json:"Other,omitempty"`
+}
+
+type ASFFInstanceDetails struct {
+	ImageId string `json:"ImageId"`
+}
+
+type ASFFWorkflow struct {
+	Status string `json:"Status"`
+}
+
+// NewASFFFindings returns one finding for each instance launched from a privately shared, unknown,
+// unverified-but-known or unverified AMI. Finding IDs are derived from the region, instance and AMI, so a later scan
+// updates the same finding rather than creating a new one, keeping its CreatedAt from opts.FindingsCreatedAt.
+// Findings belong to the account of their instance and are imported through the scanning account's product ARN,
+// which needs that account to be the Security Hub administrator of the others.
+func NewASFFFindings(result *scanner.Result, opts Options) []ASFFFinding {
+	hubRegion := opts.SecurityHubRegion
+	if hubRegion == "" {
+		hubRegion = DefaultSecurityHubRegion
+	}
+	account := result.Identity.Account
+	productArn := fmt.Sprintf("arn:%s:securityhub:%s:%s:product/%s/default", result.Identity.Partition(), hubRegion,
+		account, account)
+	timestamp := result.ScannedAt
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	now := timestamp.UTC().Format(time.RFC3339)
+
+	findings := []ASFFFinding{}
+	for _, ami := range result.AMIs() {
+		severity, ok := asffSeverity[ami.Status]
+		if !ok {
+			continue
+		}
+		for _, instance := range result.Instances(ami) {
+			instanceARN := instanceARN(result.Identity, instance)
+			id := findingID(instance.Region, instance.ID, ami.ID)
+			createdAt, ok := opts.FindingsCreatedAt[id]
+			if !ok {
+				createdAt = now
+			}
+			finding := ASFFFinding{
+				SchemaVersion: asffSchemaVersion,
+				Id:            id,
+				ProductArn:    productArn,
+				GeneratorId:   asffGeneratorPrefix + ami.Status.Code(),
+				AwsAccountId:  instance.Account,
+				Types:         []string{"Software and Configuration Checks/AWS Security Best Practices"},
+				CreatedAt:     createdAt,
+				UpdatedAt:     now,
+				Severity:      ASFFSeverity{Label: severity},
+				Title:         fmt.Sprintf("EC2 instance launched from a %s AMI", ami.Status.Code()),
+				Description:   truncate(findingMessage(ami, instance), 1024),
+				SourceUrl:     allowedAMIsURI,
+				ProductFields: map[string]string{
+					"whoami-scanner/Status":  ami.Status.Code(),
+					"whoami-scanner/Reason":  truncate(ami.Reason, 1024),
+					"whoami-scanner/OwnerId": ami.OwnerID,
+					"whoami-scanner/Version": opts.ToolVersion,
+				},
+				Resources: []ASFFResource{
+					{
+						Type:      "AwsEc2Instance",
+						Id:        instanceARN,
+						Partition: result.Identity.Partition(),
+						Region:    instance.Region,
+						Details:   &ASFFDetails{AwsEc2Instance: &ASFFInstanceDetails{ImageId: ami.ID}},
+					},
+					{
+						Type:      "Other",
+						Id:        amiARN(result.Identity, ami),
+						Partition: result.Identity.Partition(),
+						Region:    ami.Region,
+						Details: &ASFFDetails{Other: map[string]string{
+							"OwnerId":   ami.OwnerID,
+							"OwnerName": ami.OwnerName,
+							"Name":      truncate(ami.Name, 1024),
+						}},
+					},
+				},
+				RecordState: "ACTIVE",
+				Workflow:    ASFFWorkflow{Status: "NEW"},
+			}
+			if instance.Name != "" {
+				finding.Resources[0].Tags = map[string]string{"Name": instance.Name}
+			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// WriteASFF writes the findings from NewASFFFindings as a JSON document that can be passed to
+// `aws securityhub batch-import-findings --cli-input-json`.
+func WriteASFF(w io.Writer, result *scanner.Result, opts Options) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(struct {
+		Findings []ASFFFinding `json:"Findings"`
+	}{NewASFFFindings(result, opts)})
+}
+
+// truncate shortens s to at most n bytes, as Security Hub rejects findings with overly long fields.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
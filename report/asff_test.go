@@ -0,0 +1,48 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteASFF(t *testing.T) {
+	var buf bytes.Buffer
+	opts := Options{
+		SecurityHubRegion: "eu-west-1",
+		FindingsCreatedAt: map[string]string{"whoami-scanner/eu-west-1/i-shared/ami-shared": "2025-01-01T00:00:00Z"},
+	}
+	if err := Write("asff", &buf, testResult(), opts); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var got struct {
+		Findings []ASFFFinding
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	if len(got.Findings) != 3 {
+		t.Fatalf("got %d findings, want one per instance on a private shared or unverified AMI", len(got.Findings))
+	}
+	shared, unverified := got.Findings[0], got.Findings[1]
+	if shared.Id != "whoami-scanner/eu-west-1/i-shared/ami-shared" || shared.Severity.Label != "MEDIUM" {
+		t.Errorf("private shared finding = %s with severity %s", shared.Id, shared.Severity.Label)
+	}
+	if shared.CreatedAt != "2025-01-01T00:00:00Z" || shared.UpdatedAt == shared.CreatedAt {
+		t.Errorf("private shared finding created at %s, updated at %s, want it to keep its CreatedAt", shared.CreatedAt,
+			shared.UpdatedAt)
+	}
+	if unverified.CreatedAt != unverified.UpdatedAt {
+		t.Errorf("new finding created at %s, updated at %s, want the scan time", unverified.CreatedAt, unverified.UpdatedAt)
+	}
+	if unverified.Severity.Label != "HIGH" || unverified.GeneratorId != "whoami-scanner/unverified" {
+		t.Errorf("unverified finding has severity %s and generator %s", unverified.Severity.Label, unverified.GeneratorId)
+	}
+	if want := "arn:aws:securityhub:eu-west-1:111111111111:product/111111111111/default"; unverified.ProductArn != want {
+		t.Errorf("product ARN = %s, want %s", unverified.ProductArn, want)
+	}
+	if len(unverified.Resources) != 2 || unverified.Resources[0].Details.AwsEc2Instance.ImageId != "ami-unverified" {
+		t.Errorf("resources = %+v", unverified.Resources)
+	}
+}
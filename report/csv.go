@@ -0,0 +1,64 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+// DefaultDelimiter is the CSV field delimiter used when Options.Delimiter is not set.
+const DefaultDelimiter = ','
+
+var csvHeader = []string{
+	"Instance ID", "Instance Name", "Region", "AMI ID", "whoAMI status", "Public", "Owner Alias", "Owner ID",
+	"Vendor Name", "AMI Name", "AMI Description", "Reason", "Account ID",
+}
+
+// WriteCSV writes an RFC 4180 CSV document with one row per instance, preceded by a header row. Fields containing
+// the delimiter, quotes or newlines are quoted.
+func WriteCSV(w io.Writer, result *scanner.Result, opts Options) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = opts.Delimiter
+	if writer.Comma == 0 {
+		writer.Comma = DefaultDelimiter
+	}
+
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, ami := range result.AMIs() {
+		instances := result.Instances(ami)
+		if len(instances) == 0 {
+			// Keep the AMI in the report even if no instance was recorded for it
+			instances = []scanner.Instance{{Account: ami.Account, Region: ami.Region}}
+		}
+		for _, instance := range instances {
+			err := writer.Write([]string{
+				instance.ID, instance.Name, instance.Region, ami.ID, ami.Status.String(), ami.Public,
+				ami.OwnerAlias, ami.OwnerID, ami.OwnerName, ami.Name, ami.Description, ami.Reason,
+				instance.Account,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ParseDelimiter parses a CSV delimiter given on the command line. It must be a single character other than a
+// quote or newline; "tab" and `\t` are accepted for a tab.
+func ParseDelimiter(s string) (rune, error) {
+	if s == "tab" || s == `\t` {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("invalid CSV delimiter %q: must be a single character other than a quote or newline", s)
+	}
+	return r, nil
+}
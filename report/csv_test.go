@@ -0,0 +1,75 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+func TestWriteCSV(t *testing.T) {
+	tests := []struct {
+		name      string
+		delimiter rune
+		want      rune
+	}{
+		{name: "default delimiter", want: ','},
+		{name: "pipe delimiter", delimiter: '|', want: '|'},
+		{name: "tab delimiter", delimiter: '\t', want: '\t'},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write("csv", &buf, testResult(), Options{Delimiter: tt.delimiter}); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			reader := csv.NewReader(&buf)
+			reader.Comma = tt.want
+			records, err := reader.ReadAll()
+			if err != nil {
+				t.Fatalf("report is not valid CSV: %v", err)
+			}
+			if len(records) != 6 {
+				t.Fatalf("got %d rows, want a header and 5 instances: %q", len(records), records)
+			}
+			if strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+				t.Errorf("header = %q", records[0])
+			}
+
+			want := []string{"i-unverified-1", "worker, blue", "eu-west-1", "ami-unverified", "Unverified", "Public",
+				"", "222222222222", "Unknown", "ubuntu|jammy", "line one\nline \"two\"", "owner 222222222222 is unverified",
+				"111111111111"}
+			if got := records[4]; strings.Join(got, "\x00") != strings.Join(want, "\x00") {
+				t.Errorf("row = %q, want %q", got, want)
+			}
+			if got := records[1][0]; got != "i-allowed" {
+				t.Errorf("first row is instance %q, want rows ordered by region then AMI ID", got)
+			}
+		})
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    rune
+		wantErr bool
+	}{
+		{input: ",", want: ','},
+		{input: "|", want: '|'},
+		{input: ";", want: ';'},
+		{input: "tab", want: '\t'},
+		{input: `\t`, want: '\t'},
+		{input: "", wantErr: true},
+		{input: "||", wantErr: true},
+		{input: `"`, wantErr: true},
+		{input: "\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDelimiter(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseDelimiter(%q) = %q, %v, want %q (error: %v)", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package report
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+//go:embed templates/report.html
+var htmlTemplateText string
+
+var htmlTemplate = template.Must(template.New("report.html").Parse(htmlTemplateText))
+
+// statusDescriptions explains each status, as in the summary key printed to the terminal.
+var statusDescriptions = map[scanner.Status]string{
+	scanner.StatusSelfHosted: "AMIs from this account.",
+	scanner.StatusAllowed:    "AMIs from an allowed account per the AWS Allowed AMIs API.",
+	scanner.StatusTrusted:    "AMIs from a trusted account per user input to whoAMI-scanner.",
+	scanner.StatusVerified:   "AMIs from verified accounts (verified by Amazon).",
+	scanner.StatusPrivateShared: "AMIs shared privately with this account but NOT from a verified, trusted or allowed " +
+		"account. If you trust this account, add it to your Allowed AMIs settings or specify it as trusted in the " +
+		"whoAMI-scanner command line.",
+	scanner.StatusUnknown: "AMIs with an owner alias that whoAMI-scanner does not recognize. Check who owns " +
+		"them before trusting them.",
+	scanner.StatusUnverifiedButKnown: "AMIs from unverified accounts, but the account ID is in fwdcloudsec's " +
+		"known_aws_accounts mapping. These are likely safe to use but worth investigating.",
+	scanner.StatusUnverified: "AMIs from unverified accounts. Be cautious with these unless they are from accounts " +
+		"you control. If not from your accounts, look to replace these with AMIs from verified accounts.",
+}
+
+// statusColours is the colour of each status in the summary key.
+var statusColours = map[scanner.Status]string{
+	scanner.StatusSelfHosted:         "green",
+	scanner.StatusAllowed:            "green",
+	scanner.StatusTrusted:            "green",
+	scanner.StatusVerified:           "green",
+	scanner.StatusPrivateShared:      "yellow",
+	scanner.StatusUnknown:            "yellow",
+	scanner.StatusUnverifiedButKnown: "yellow",
+	scanner.StatusUnverified:         "red",
+}
+
+type htmlReport struct {
+	ToolVersion      string
+	Identity         scanner.Identity
+	ScannedAt        string
+	Errors           []scanner.ScanError
+	AccountErrors    []scanner.AccountError
+	TotalInstances   int
+	TotalAMIs        int
+	PermissionDenied bool
+	Enabled          int
+	AuditMode        int
+	Disabled         int
+	Regions          []htmlRegion
+	Groups           []htmlGroup
+}
+
+type htmlRegion struct {
+	Name      string
+	State     string
+	Providers []string
+	Complete  bool
+}
+
+type htmlGroup struct {
+	Status      string
+	Code        string
+	Colour      string
+	Description string
+	AMIs        int
+	Rows        []htmlRow
+}
+
+type htmlRow struct {
+	InstanceID   string
+	InstanceName string
+	InstanceURL  string
+	Region       string
+	AMIID        string
+	AMIName      string
+	AMIURL       string
+	OwnerID      string
+	OwnerAlias   string
+	OwnerName    string
+	Public       string
+	Reason       string
+}
+
+// WriteHTML writes a single static HTML page with the summary key, the Allowed AMIs state of each region and the
+// instances grouped by the status of their AMI. The tables can be sorted and filtered in the browser, and link to
+// the instances and AMIs in the AWS console. The page has no external dependencies.
+func WriteHTML(w io.Writer, result *scanner.Result, opts Options) error {
+	data := htmlReport{
+		ToolVersion:      opts.ToolVersion,
+		Identity:         result.Identity,
+		Errors:           result.Errors,
+		AccountErrors:    result.AccountErrors,
+		TotalInstances:   result.TotalInstances,
+		TotalAMIs:        len(result.ProcessedAMIs),
+		PermissionDenied: result.AllowedAMIPermissionDenied,
+	}
+	if !result.ScannedAt.IsZero() {
+		data.ScannedAt = result.ScannedAt.UTC().Format(time.RFC1123)
+	}
+	if !result.AllowedAMIPermissionDenied {
+		data.Enabled, data.AuditMode, data.Disabled = result.CountRegionsWithAllowedAmisEnabled()
+	}
+
+	incomplete := make(map[scanner.RegionKey]bool)
+	for _, region := range result.IncompleteRegions() {
+		incomplete[region] = true
+	}
+	for _, region := range result.Regions {
+		state := result.AllowedAMIStateByRegion[region]
+		if state == "" {
+			state = "unknown"
+		}
+		data.Regions = append(data.Regions, htmlRegion{
+			Name:      result.RegionLabel(region),
+			State:     state,
+			Providers: result.AllowedAMIAccountsByRegion[region],
+			Complete:  !incomplete[region],
+		})
+	}
+
+	groups := make(map[scanner.Status]*htmlGroup)
+	for _, status := range scanner.Statuses {
+		groups[status] = &htmlGroup{
+			Status:      status.String(),
+			Code:        status.Code(),
+			Colour:      statusColours[status],
+			Description: statusDescriptions[status],
+		}
+	}
+	host := consoleHost(result.Identity.Partition())
+	for _, ami := range result.AMIs() {
+		group, ok := groups[ami.Status]
+		if !ok {
+			continue
+		}
+		group.AMIs++
+		for _, instance := range result.Instances(ami) {
+			group.Rows = append(group.Rows, htmlRow{
+				InstanceID:   instance.ID,
+				InstanceName: instance.Name,
+				InstanceURL:  consoleURL(host, instance.Region, "InstanceDetails:instanceId="+instance.ID),
+				Region:       result.RegionLabel(ami.RegionKey()),
+				AMIID:        ami.ID,
+				AMIName:      ami.Name,
+				AMIURL:       consoleURL(host, ami.Region, "ImageDetails:imageId="+ami.ID),
+				OwnerID:      ami.OwnerID,
+				OwnerAlias:   ami.OwnerAlias,
+				OwnerName:    ami.OwnerName,
+				Public:       ami.Public,
+				Reason:       ami.Reason,
+			})
+		}
+	}
+	// Unverified AMIs come first, as they need the most attention
+	for i := len(scanner.Statuses) - 1; i >= 0; i-- {
+		data.Groups = append(data.Groups, *groups[scanner.Statuses[i]])
+	}
+
+	return htmlTemplate.Execute(w, data)
+}
+
+// consoleHost returns the AWS console host name of a partition.
+func consoleHost(partition string) string {
+	switch partition {
+	case "aws-cn":
+		return "console.amazonaws.cn"
+	case "aws-us-gov":
+		return "console.amazonaws-us-gov.com"
+	default:
+		return "console.aws.amazon.com"
+	}
+}
+
+// consoleURL links to a page of the EC2 console in a region.
+func consoleURL(host, region, fragment string) string {
+	return fmt.Sprintf("https://%s/ec2/home?region=%s#%s", host, url.QueryEscape(region), fragment)
+}
@@ -0,0 +1,43 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+func TestWriteHTML(t *testing.T) {
+	result := testResult()
+	// Instance names come from tags anyone with ec2:CreateTags can set, so they must be escaped
+	key := scanner.AMIKey{Account: testAccount, Region: "eu-west-1", ID: "ami-shared"}
+	result.AMIToInstances[key][0].Name = "<script>alert(1)</script>"
+
+	var buf bytes.Buffer
+	if err := Write("html", &buf, result, Options{ToolVersion: "1.2.3"}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	page := buf.String()
+
+	for _, want := range []string{
+		`<a href="https://console.aws.amazon.com/ec2/home?region=eu-west-1#InstanceDetails:instanceId=i-unverified-1">i-unverified-1</a>`,
+		`<a href="https://console.aws.amazon.com/ec2/home?region=us-east-1#ImageDetails:imageId=ami-verified">ami-verified</a>`,
+		`<td>us-east-1</td><td>enabled</td><td>333333333333</td><td>complete</td>`,
+		`<td>eu-west-1</td><td>disabled</td><td></td><td>incomplete</td>`,
+		`Enabled / audit mode / disabled: 1 / 0 / 1.`,
+		`This scan is incomplete.`,
+		`&lt;script&gt;alert(1)&lt;/script&gt;`,
+		`2 instances on 1 AMIs`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("report does not contain %q", want)
+		}
+	}
+	if strings.Contains(page, "<script>alert(1)") {
+		t.Error("instance name is not escaped")
+	}
+	if strings.Index(page, `id="unverified"`) > strings.Index(page, `id="verified"`) {
+		t.Error("unverified instances should be listed before verified ones")
+	}
+}
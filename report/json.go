@@ -0,0 +1,192 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+// JSONSchemaVersion is the version of the JSON report schema documented in docs/json-report.md. The minor version
+// is bumped when fields are added and the major version when fields are changed or removed.
+const JSONSchemaVersion = "1.1"
+
+// JSONReport is the document written by WriteJSON.
+type JSONReport struct {
+	SchemaVersion string       `json:"schema_version"`
+	Tool          JSONTool     `json:"tool"`
+	ScannedAt     time.Time    `json:"scanned_at"`
+	Identity      JSONIdentity `json:"identity"`
+	Accounts      []string     `json:"accounts"`
+	Complete      bool         `json:"complete"`
+	Errors        []JSONError  `json:"errors"`
+	// AccountErrors lists the accounts that could not be scanned at all
+	AccountErrors []JSONAccountError `json:"account_errors"`
+	Summary       JSONSummary        `json:"summary"`
+	Regions       []JSONRegion       `json:"regions"`
+	AMIs          []JSONAMI          `json:"amis"`
+}
+
+type JSONTool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type JSONIdentity struct {
+	Account string `json:"account"`
+	Arn     string `json:"arn"`
+}
+
+type JSONError struct {
+	Account   string   `json:"account"`
+	Region    string   `json:"region"`
+	Operation string   `json:"operation"`
+	AMIs      []string `json:"amis"`
+	Message   string   `json:"message"`
+}
+
+type JSONAccountError struct {
+	Account string `json:"account"`
+	Message string `json:"message"`
+}
+
+type JSONSummary struct {
+	TotalInstances int `json:"total_instances"`
+	TotalAMIs      int `json:"total_amis"`
+	// AMIsByStatus counts the AMIs of each status, keyed by status code. Every status is present.
+	AMIsByStatus map[string]int `json:"amis_by_status"`
+}
+
+type JSONRegion struct {
+	Account string `json:"account"`
+	Name    string `json:"name"`
+	// AllowedAMIsState is "enabled", "audit-mode", "disabled" or "unknown" when it could not be read
+	AllowedAMIsState      string   `json:"allowed_amis_state"`
+	AllowedImageProviders []string `json:"allowed_image_providers"`
+	Complete              bool     `json:"complete"`
+}
+
+type JSONAMI struct {
+	ID          string         `json:"id"`
+	Account     string         `json:"account"`
+	Region      string         `json:"region"`
+	Status      scanner.Status `json:"status"`
+	Reason      string         `json:"reason"`
+	Public      bool           `json:"public"`
+	OwnerID     string         `json:"owner_id"`
+	OwnerAlias  string         `json:"owner_alias"`
+	OwnerName   string         `json:"owner_name"`
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Instances   []JSONInstance `json:"instances"`
+}
+
+type JSONInstance struct {
+	ID      string `json:"id"`
+	Account string `json:"account"`
+	Region  string `json:"region"`
+	Name    string `json:"name"`
+}
+
+// NewJSONReport converts a scan result to the JSON report schema.
+func NewJSONReport(result *scanner.Result, opts Options) JSONReport {
+	report := JSONReport{
+		SchemaVersion: JSONSchemaVersion,
+		Tool:          JSONTool{Name: "whoAMI-scanner", Version: opts.ToolVersion},
+		ScannedAt:     result.ScannedAt,
+		Identity:      JSONIdentity{Account: result.Identity.Account, Arn: result.Identity.Arn},
+		Accounts:      nonNil(result.Accounts),
+		Complete:      !result.Incomplete(),
+		Errors:        []JSONError{},
+		AccountErrors: []JSONAccountError{},
+		Summary: JSONSummary{
+			TotalInstances: result.TotalInstances,
+			TotalAMIs:      len(result.ProcessedAMIs),
+			AMIsByStatus:   make(map[string]int),
+		},
+		Regions: []JSONRegion{},
+		AMIs:    []JSONAMI{},
+	}
+
+	for _, scanErr := range result.Errors {
+		report.Errors = append(report.Errors, JSONError{
+			Account:   scanErr.Account,
+			Region:    scanErr.Region,
+			Operation: scanErr.Operation,
+			AMIs:      nonNil(scanErr.Resources),
+			Message:   scanErr.Err.Error(),
+		})
+	}
+	for _, accountErr := range result.AccountErrors {
+		report.AccountErrors = append(report.AccountErrors, JSONAccountError{
+			Account: accountErr.Account,
+			Message: accountErr.Err.Error(),
+		})
+	}
+
+	counts := result.CountByStatus()
+	for _, status := range scanner.Statuses {
+		report.Summary.AMIsByStatus[status.Code()] = counts[status]
+	}
+
+	incomplete := make(map[scanner.RegionKey]bool)
+	for _, region := range result.IncompleteRegions() {
+		incomplete[region] = true
+	}
+	for _, region := range result.Regions {
+		state := result.AllowedAMIStateByRegion[region]
+		if state == "" {
+			state = "unknown"
+		}
+		report.Regions = append(report.Regions, JSONRegion{
+			Account:               region.Account,
+			Name:                  region.Region,
+			AllowedAMIsState:      state,
+			AllowedImageProviders: nonNil(result.AllowedAMIAccountsByRegion[region]),
+			Complete:              !incomplete[region],
+		})
+	}
+
+	for _, ami := range result.AMIs() {
+		jsonAMI := JSONAMI{
+			ID:          ami.ID,
+			Account:     ami.Account,
+			Region:      ami.Region,
+			Status:      ami.Status,
+			Reason:      ami.Reason,
+			Public:      ami.Public == "Public",
+			OwnerID:     ami.OwnerID,
+			OwnerAlias:  ami.OwnerAlias,
+			OwnerName:   ami.OwnerName,
+			Name:        ami.Name,
+			Description: ami.Description,
+			Instances:   []JSONInstance{},
+		}
+		for _, instance := range result.Instances(ami) {
+			jsonAMI.Instances = append(jsonAMI.Instances, JSONInstance{
+				ID:      instance.ID,
+				Account: instance.Account,
+				Region:  instance.Region,
+				Name:    instance.Name,
+			})
+		}
+		report.AMIs = append(report.AMIs, jsonAMI)
+	}
+	return report
+}
+
+// WriteJSON writes the scan result as an indented JSON document following the schema in docs/json-report.md.
+func WriteJSON(w io.Writer, result *scanner.Result, opts Options) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(NewJSONReport(result, opts))
+}
+
+// nonNil returns an empty slice in place of nil so it is encoded as [] rather than null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,60 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write("json", &buf, testResult(), Options{ToolVersion: "1.2.3"}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var got JSONReport
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("report is not valid JSON: %v\n%s", err, buf.String())
+	}
+
+	if got.SchemaVersion != JSONSchemaVersion || got.Tool.Version != "1.2.3" {
+		t.Errorf("schema_version, tool.version = %q, %q", got.SchemaVersion, got.Tool.Version)
+	}
+	if got.Identity.Account != "111111111111" || len(got.Accounts) != 1 || len(got.AccountErrors) != 0 {
+		t.Errorf("identity.account, accounts, account_errors = %q, %v, %v", got.Identity.Account, got.Accounts,
+			got.AccountErrors)
+	}
+	if got.Complete || len(got.Errors) != 1 || got.Errors[0].AMIs[0] != "ami-lost" {
+		t.Errorf("complete = %v, errors = %+v, want one error for ami-lost", got.Complete, got.Errors)
+	}
+	if got.Summary.TotalAMIs != 5 || got.Summary.AMIsByStatus["unverified"] != 1 || got.Summary.AMIsByStatus["trusted"] != 0 {
+		t.Errorf("summary = %+v", got.Summary)
+	}
+	if len(got.Regions) != 2 || got.Regions[0].Name != "us-east-1" || !got.Regions[0].Complete || got.Regions[1].Complete {
+		t.Errorf("regions = %+v", got.Regions)
+	}
+
+	var ids []string
+	for _, ami := range got.AMIs {
+		ids = append(ids, ami.ID)
+	}
+	want := []string{"ami-allowed", "ami-verified", "ami-shared", "ami-unverified"}
+	if len(ids) != len(want) {
+		t.Fatalf("amis = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("amis = %v, want %v", ids, want)
+		}
+	}
+	unverified := got.AMIs[3]
+	if unverified.Status != scanner.StatusUnverified || unverified.Public != true || len(unverified.Instances) != 2 ||
+		unverified.Account != "111111111111" || unverified.Instances[0].Account != "111111111111" {
+		t.Errorf("unverified AMI = %+v", unverified)
+	}
+	if shared := got.AMIs[2]; shared.Public || shared.Instances[0].Name != "db" {
+		t.Errorf("shared AMI = %+v", shared)
+	}
+}
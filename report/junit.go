@@ -0,0 +1,168 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+// junitFailures are the statuses for which an instance's testcase fails.
+var junitFailures = map[scanner.Status]bool{
+	scanner.StatusPrivateShared: true,
+	scanner.StatusUnverified:    true,
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Errors     int             `xml:"errors,attr"`
+	Timestamp  string          `xml:"timestamp,attr,omitempty"`
+	Properties []junitProperty `xml:"properties>property,omitempty"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes a JUnit XML report with a testsuite per region and a testcase per instance. A testcase fails when
+// the instance was launched from an unverified or privately shared AMI. Each part of the scan that failed is an
+// errored testcase, so incomplete scans are not mistaken for passing ones.
+func WriteJUnit(w io.Writer, result *scanner.Result, opts Options) error {
+	suites := junitTestSuites{Name: toolName}
+	timestamp := ""
+	if !result.ScannedAt.IsZero() {
+		timestamp = result.ScannedAt.UTC().Format(time.RFC3339)
+	}
+
+	regions := append([]scanner.RegionKey(nil), result.Regions...)
+	byRegion := make(map[scanner.RegionKey]*junitTestSuite)
+	for _, region := range regions {
+		state := result.AllowedAMIStateByRegion[region]
+		if state == "" {
+			state = "unknown"
+		}
+		byRegion[region] = &junitTestSuite{
+			Name:       result.RegionLabel(region),
+			Timestamp:  timestamp,
+			Properties: []junitProperty{{Name: "allowed-amis-state", Value: state}},
+		}
+	}
+	suite := func(region scanner.RegionKey) *junitTestSuite {
+		if byRegion[region] == nil {
+			byRegion[region] = &junitTestSuite{Name: result.RegionLabel(region), Timestamp: timestamp}
+			regions = append(regions, region)
+		}
+		return byRegion[region]
+	}
+	className := func(region scanner.RegionKey) string {
+		return "whoami." + strings.ReplaceAll(result.RegionLabel(region), "/", ".")
+	}
+
+	for _, ami := range result.AMIs() {
+		for _, instance := range result.Instances(ami) {
+			testcase := junitTestCase{
+				Name:      instance.ID,
+				ClassName: className(ami.RegionKey()),
+				SystemOut: fmt.Sprintf("AMI %s (%s) is %s: %s", ami.ID, ami.Name, ami.Status.Code(), ami.Reason),
+			}
+			if instance.Name != "" {
+				testcase.Name = fmt.Sprintf("%s (%s)", instance.ID, instance.Name)
+			}
+			if junitFailures[ami.Status] {
+				testcase.Failure = &junitProblem{
+					Message: fmt.Sprintf("%s AMI %s %q from owner %s", ami.Status, ami.ID, ami.Name, ownerDisplayName(ami)),
+					Type:    ami.Status.Code(),
+					Text:    findingMessage(ami, instance),
+				}
+			}
+			s := suite(ami.RegionKey())
+			s.Cases = append(s.Cases, testcase)
+		}
+	}
+
+	for _, scanErr := range result.Errors {
+		s := suite(scanErr.RegionKey())
+		s.Cases = append(s.Cases, junitTestCase{
+			Name:      scanErr.Operation,
+			ClassName: className(scanErr.RegionKey()),
+			Error: &junitProblem{
+				Message: "scan incomplete",
+				Type:    scanErr.Operation,
+				Text:    scanErr.Error(),
+			},
+		})
+	}
+
+	// An account that could not be scanned has no regions, so it gets a suite of its own
+	for _, accountErr := range result.AccountErrors {
+		region := scanner.RegionKey{Account: accountErr.Account}
+		byRegion[region] = &junitTestSuite{Name: accountErr.Account, Timestamp: timestamp, Cases: []junitTestCase{{
+			Name:      "account",
+			ClassName: "whoami." + accountErr.Account,
+			Error: &junitProblem{
+				Message: "account not scanned",
+				Type:    "AccountError",
+				Text:    accountErr.Error(),
+			},
+		}}}
+		regions = append(regions, region)
+	}
+
+	for _, region := range regions {
+		s := byRegion[region]
+		for _, testcase := range s.Cases {
+			s.Tests++
+			if testcase.Failure != nil {
+				s.Failures++
+			}
+			if testcase.Error != nil {
+				s.Errors++
+			}
+		}
+		suites.Tests += s.Tests
+		suites.Failures += s.Failures
+		suites.Errors += s.Errors
+		suites.Suites = append(suites.Suites, *s)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,68 @@
+package report
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write("junit", &buf, testResult(), Options{}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var got junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("report is not valid XML: %v\n%s", err, buf.String())
+	}
+	if got.Tests != 6 || got.Failures != 3 || got.Errors != 1 {
+		t.Errorf("tests, failures, errors = %d, %d, %d, want 6, 3, 1", got.Tests, got.Failures, got.Errors)
+	}
+	if len(got.Suites) != 2 || got.Suites[0].Name != "us-east-1" || got.Suites[1].Name != "eu-west-1" {
+		t.Fatalf("suites = %+v, want one per region in scan order", got.Suites)
+	}
+
+	usEast, euWest := got.Suites[0], got.Suites[1]
+	if usEast.Tests != 2 || usEast.Failures != 0 || usEast.Properties[0].Value != "enabled" {
+		t.Errorf("us-east-1 suite = %+v", usEast)
+	}
+	if euWest.Tests != 4 || euWest.Failures != 3 || euWest.Errors != 1 {
+		t.Errorf("eu-west-1 suite has %d tests, %d failures, %d errors", euWest.Tests, euWest.Failures, euWest.Errors)
+	}
+
+	shared := euWest.Cases[0]
+	if shared.Name != "i-shared (db)" || shared.Failure == nil {
+		t.Fatalf("first eu-west-1 testcase = %+v, want a failure for i-shared", shared)
+	}
+	if msg := shared.Failure.Message; !strings.Contains(msg, "444444444444") || !strings.Contains(msg, `"shared"`) {
+		t.Errorf("failure message %q does not name the AMI owner and name", msg)
+	}
+}
+
+func TestWriteJUnitAccounts(t *testing.T) {
+	result := testResult()
+	result.AccountErrors = []scanner.AccountError{{Account: "555555555555", Err: errors.New("AccessDenied")}}
+
+	var buf bytes.Buffer
+	if err := Write("junit", &buf, result, Options{}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	var got junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("report is not valid XML: %v\n%s", err, buf.String())
+	}
+	if len(got.Suites) != 3 || got.Suites[0].Name != "111111111111/us-east-1" || got.Suites[2].Name != "555555555555" {
+		t.Fatalf("suites = %+v, want account-qualified regions and a suite for the failed account", got.Suites)
+	}
+	if got.Errors != 2 || got.Suites[2].Cases[0].Error == nil {
+		t.Errorf("errors = %d, failed account suite = %+v", got.Errors, got.Suites[2])
+	}
+	if className := got.Suites[0].Cases[0].ClassName; className != "whoami.111111111111.us-east-1" {
+		t.Errorf("classname = %q", className)
+	}
+}
@@ -0,0 +1,201 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+// DefaultMarkdownMaxLength is the maximum length of a Markdown report when Options.MarkdownMaxLength is not set. It is
+// the length limit of GitHub issue and pull request comments; Jira comments are limited to 32767 characters.
+const DefaultMarkdownMaxLength = 65536
+
+// markdownStatuses are the statuses whose instances are listed in the Markdown report, most severe first.
+var markdownStatuses = []scanner.Status{
+	scanner.StatusUnverified,
+	scanner.StatusUnverifiedButKnown,
+	scanner.StatusUnknown,
+	scanner.StatusPrivateShared,
+}
+
+var markdownEmoji = map[string]string{
+	"green":  ":green_circle:",
+	"yellow": ":yellow_circle:",
+	"red":    ":red_circle:",
+}
+
+// WriteMarkdown writes a Markdown summary suitable for pull request and ticket comments: the AMI counts per status,
+// the Allowed AMIs state across regions, and a collapsible table of the instances launched from privately shared,
+// unknown, unverified-but-known and unverified AMIs. Tables are truncated, with a note, so the report fits in
+// Options.MarkdownMaxLength characters.
+func WriteMarkdown(w io.Writer, result *scanner.Result, opts Options) error {
+	maxLength := opts.MarkdownMaxLength
+	if maxLength <= 0 {
+		maxLength = DefaultMarkdownMaxLength
+	}
+
+	var b strings.Builder
+	if result.MultiAccount() {
+		fmt.Fprintf(&b, "## whoAMI-scanner report for %d accounts\n\n", len(result.Accounts)+len(result.AccountErrors))
+	} else {
+		fmt.Fprintf(&b, "## whoAMI-scanner report for %s\n\n", result.Identity.Account)
+	}
+	if len(result.Errors) > 0 {
+		fmt.Fprintf(&b, "> [!WARNING]\n> The scan is incomplete: %d API calls failed after retries in %s, so some "+
+			"instances may be missing.\n\n", len(result.Errors), strings.Join(regionLabels(result, result.IncompleteRegions()), ", "))
+	}
+	if len(result.AccountErrors) > 0 {
+		var accounts []string
+		for _, accountErr := range result.AccountErrors {
+			accounts = append(accounts, accountErr.Account)
+		}
+		fmt.Fprintf(&b, "> [!WARNING]\n> %d accounts could not be scanned: %s.\n\n", len(accounts),
+			strings.Join(accounts, ", "))
+	}
+
+	b.WriteString("| Status | AMIs |\n|---|---:|\n")
+	counts := result.CountByStatus()
+	for _, status := range scanner.Statuses {
+		fmt.Fprintf(&b, "| %s %s | %d |\n", markdownEmoji[statusColours[status]], status, counts[status])
+	}
+	fmt.Fprintf(&b, "| **Total AMIs** | **%d** |\n| **Total instances** | **%d** |\n\n", len(result.ProcessedAMIs),
+		result.TotalInstances)
+
+	if result.AllowedAMIPermissionDenied {
+		b.WriteString("Allowed AMIs state: unknown (permission denied).\n\n")
+	} else {
+		enabled, auditMode, disabled := result.CountRegionsWithAllowedAmisEnabled()
+		fmt.Fprintf(&b, "Allowed AMIs state across %d regions: **%d** enabled, **%d** audit mode, **%d** disabled.\n\n",
+			len(result.Regions), enabled, auditMode, disabled)
+	}
+
+	// Lay out each section first, so the space taken by every header can be reserved before rows are added
+	type section struct {
+		head, tail, note string
+		rows             []string
+	}
+	var sections []section
+	for _, status := range markdownStatuses {
+		var rows []string
+		amis := 0
+		for _, ami := range result.AMIs() {
+			if ami.Status != status {
+				continue
+			}
+			amis++
+			for _, instance := range result.Instances(ami) {
+				rows = append(rows, fmt.Sprintf("| %s | %s | %s | %s | %s | %s |\n",
+					markdownCell(instance.ID), markdownCell(instance.Name), markdownCell(result.RegionLabel(ami.RegionKey())),
+					markdownCell(ami.ID), markdownCell(ami.Name), markdownCell(ownerDisplayName(ami))))
+			}
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		sections = append(sections, section{
+			head: fmt.Sprintf("<details>\n<summary>%s %s: %d instances on %d AMIs</summary>\n\n"+
+				"| Instance | Name | Region | AMI | AMI name | Owner |\n|---|---|---|---|---|---|\n",
+				markdownEmoji[statusColours[status]], status, len(rows), amis),
+			tail: "\n</details>\n\n",
+			note: fmt.Sprintf("\n_%d more instances not shown to fit the comment length limit._\n", len(rows)),
+			rows: rows,
+		})
+	}
+
+	footer := "_Generated by [whoAMI-scanner](" + toolURI + ")"
+	if opts.ToolVersion != "" {
+		footer += " v" + opts.ToolVersion
+	}
+	footer += "._\n"
+
+	// When even the headers of the sections do not fit, the least severe sections are left out, with a note
+	available := maxLength - utf8.RuneCountInString(b.String()) - utf8.RuneCountInString(footer)
+	omitted, omittedNote := 0, ""
+	for len(sections) > 0 {
+		reserved := utf8.RuneCountInString(omittedNote)
+		for _, s := range sections {
+			reserved += utf8.RuneCountInString(s.head) + utf8.RuneCountInString(s.tail) + utf8.RuneCountInString(s.note)
+		}
+		if reserved <= available {
+			break
+		}
+		omitted += len(sections[len(sections)-1].rows)
+		omittedNote = fmt.Sprintf("_%d more instances not shown to fit the comment length limit._\n\n", omitted)
+		sections = sections[:len(sections)-1]
+	}
+	if utf8.RuneCountInString(omittedNote) > available {
+		omittedNote = ""
+	}
+	available -= utf8.RuneCountInString(omittedNote)
+
+	// Share the space left for rows between the sections. Sections that need less than an equal share leave the rest
+	// to the larger ones.
+	needs := make([]int, len(sections))
+	for i, s := range sections {
+		available -= utf8.RuneCountInString(s.head) + utf8.RuneCountInString(s.tail) + utf8.RuneCountInString(s.note)
+		for _, row := range s.rows {
+			needs[i] += utf8.RuneCountInString(row)
+		}
+	}
+	bySize := make([]int, len(sections))
+	for i := range bySize {
+		bySize[i] = i
+	}
+	sort.SliceStable(bySize, func(a, b int) bool { return needs[bySize[a]] < needs[bySize[b]] })
+	budgets := make([]int, len(sections))
+	for n, i := range bySize {
+		budgets[i] = max(0, min(needs[i], available/(len(sections)-n)))
+		available -= budgets[i]
+	}
+
+	for i, s := range sections {
+		b.WriteString(s.head)
+		shown, used := 0, 0
+		for _, row := range s.rows {
+			length := utf8.RuneCountInString(row)
+			if used+length > budgets[i] {
+				break
+			}
+			b.WriteString(row)
+			used += length
+			shown++
+		}
+		if shown < len(s.rows) {
+			fmt.Fprintf(&b, "\n_%d more instances not shown to fit the comment length limit._\n", len(s.rows)-shown)
+		}
+		b.WriteString(s.tail)
+	}
+	b.WriteString(omittedNote)
+	b.WriteString(footer)
+
+	report := b.String()
+	// The counts alone may be longer than a very small limit, in which case the report is cut short
+	if runes := []rune(report); len(runes) > maxLength {
+		report = string(runes[:maxLength])
+	}
+	_, err := io.WriteString(w, report)
+	return err
+}
+
+// ownerDisplayName names the owner of an AMI by its alias or known vendor name, falling back to the account ID.
+func ownerDisplayName(ami scanner.AMI) string {
+	switch {
+	case ami.OwnerAlias != "":
+		return ami.OwnerAlias
+	case ami.OwnerName != "" && ami.OwnerName != scanner.AmiOwnerNameUnknown:
+		return fmt.Sprintf("%s (%s)", ami.OwnerName, ami.OwnerID)
+	default:
+		return ami.OwnerID
+	}
+}
+
+var markdownCellEscaper = strings.NewReplacer("|", `\|`, "\r", " ", "\n", " ", "<", "&lt;", ">", "&gt;", "`", "\\`")
+
+// markdownCell escapes text so it stays within a single table cell.
+func markdownCell(s string) string {
+	return markdownCellEscaper.Replace(s)
+}
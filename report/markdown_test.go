@@ -0,0 +1,98 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write("markdown", &buf, testResult(), Options{}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	report := buf.String()
+
+	for _, want := range []string{
+		"| :red_circle: Unverified | 1 |",
+		"| **Total AMIs** | **5** |",
+		"**1** enabled, **0** audit mode, **1** disabled",
+		"The scan is incomplete",
+		"<summary>:red_circle: Unverified: 2 instances on 1 AMIs</summary>",
+		`| i-unverified-1 | worker, blue | eu-west-1 | ami-unverified | ubuntu\|jammy | 222222222222 |`,
+		"<summary>:yellow_circle: Private Shared: 1 instances on 1 AMIs</summary>",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report does not contain %q\n%s", want, report)
+		}
+	}
+	if strings.Contains(report, "i-verified") || strings.Contains(report, "not shown") {
+		t.Errorf("report lists verified instances or is truncated:\n%s", report)
+	}
+}
+
+func TestWriteMarkdownTruncates(t *testing.T) {
+	result := testResult()
+	key := scanner.AMIKey{Account: testAccount, Region: "eu-west-1", ID: "ami-unverified"}
+	for i := 0; i < 1000; i++ {
+		result.AMIToInstances[key] = append(result.AMIToInstances[key], scanner.Instance{
+			ID: fmt.Sprintf("i-%017d", i), Region: "eu-west-1",
+		})
+	}
+
+	for _, maxLength := range []int{32767, 8000} {
+		var buf bytes.Buffer
+		if err := WriteMarkdown(&buf, result, Options{MarkdownMaxLength: maxLength}); err != nil {
+			t.Fatalf("WriteMarkdown() error = %v", err)
+		}
+		report := buf.String()
+		if length := utf8.RuneCountInString(report); length > maxLength {
+			t.Errorf("report is %d characters, want at most %d", length, maxLength)
+		}
+		if !strings.Contains(report, "more instances not shown to fit the comment length limit") {
+			t.Errorf("report with limit %d has no truncation note", maxLength)
+		}
+		// Later sections still fit after the unverified table is truncated
+		if !strings.Contains(report, "| i-shared | db |") || !strings.HasSuffix(report, "._\n") {
+			t.Errorf("report with limit %d is missing the private shared table or the footer", maxLength)
+		}
+	}
+}
+
+func TestWriteMarkdownHeaderLongerThanLimit(t *testing.T) {
+	result := testResult()
+	var buf bytes.Buffer
+	if err := WriteMarkdown(&buf, result, Options{}); err != nil {
+		t.Fatalf("WriteMarkdown() error = %v", err)
+	}
+	full := buf.String()
+	header, _, _ := strings.Cut(full, "<details>")
+
+	tests := []struct {
+		name      string
+		maxLength int
+		want      string
+	}{
+		{"no room for the tables", utf8.RuneCountInString(header) + 200, "3 more instances not shown"},
+		{"no room for the counts", 100, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteMarkdown(&buf, result, Options{MarkdownMaxLength: tt.maxLength}); err != nil {
+				t.Fatalf("WriteMarkdown() error = %v", err)
+			}
+			report := buf.String()
+			if length := utf8.RuneCountInString(report); length > tt.maxLength {
+				t.Errorf("report is %d characters, want at most %d\n%s", length, tt.maxLength, report)
+			}
+			if !strings.Contains(report, tt.want) {
+				t.Errorf("report does not contain %q\n%s", tt.want, report)
+			}
+		})
+	}
+}
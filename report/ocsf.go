@@ -0,0 +1,260 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+const (
+	ocsfVersion = "1.1.0"
+
+	ocsfCategoryFindings        = 2
+	ocsfClassComplianceFinding  = 2003
+	ocsfActivityCreate          = 1
+	ocsfStatusNew               = 1
+	ocsfAccountTypeAWS          = 10
+	ocsfComplianceStandard      = "whoAMI AMI provenance"
+	ocsfComplianceControlPrefix = "whoami-scanner/"
+)
+
+// ocsfOutcome is the OCSF compliance status and severity of instances launched from AMIs of a whoAMI status. It
+// follows the colour of the status in the summary key: green passes, yellow is a warning and red fails.
+type ocsfOutcome struct {
+	complianceID int
+	compliance   string
+	severityID   int
+	severity     string
+}
+
+var (
+	ocsfPass    = ocsfOutcome{complianceID: 1, compliance: "Pass", severityID: 1, severity: "Informational"}
+	ocsfWarning = ocsfOutcome{complianceID: 2, compliance: "Warning", severityID: 3, severity: "Medium"}
+	ocsfFail    = ocsfOutcome{complianceID: 3, compliance: "Fail", severityID: 4, severity: "High"}
+)
+
+var ocsfOutcomes = map[scanner.Status]ocsfOutcome{
+	scanner.StatusSelfHosted:         ocsfPass,
+	scanner.StatusAllowed:            ocsfPass,
+	scanner.StatusTrusted:            ocsfPass,
+	scanner.StatusVerified:           ocsfPass,
+	scanner.StatusPrivateShared:      ocsfWarning,
+	scanner.StatusUnknown:            ocsfWarning,
+	scanner.StatusUnverifiedButKnown: ocsfWarning,
+	scanner.StatusUnverified:         ocsfFail,
+}
+
+// OCSFFinding is an OCSF Compliance Finding (class 2003) event. Only the attributes set by whoAMI-scanner are
+// defined.
+type OCSFFinding struct {
+	ActivityID   int              `json:"activity_id"`
+	ActivityName string           `json:"activity_name"`
+	CategoryUID  int              `json:"category_uid"`
+	CategoryName string           `json:"category_name"`
+	ClassUID     int              `json:"class_uid"`
+	ClassName    string           `json:"class_name"`
+	TypeUID      int              `json:"type_uid"`
+	TypeName     string           `json:"type_name"`
+	Time         int64            `json:"time"`
+	SeverityID   int              `json:"severity_id"`
+	Severity     string           `json:"severity"`
+	StatusID     int              `json:"status_id"`
+	Status       string           `json:"status"`
+	Message      string           `json:"message"`
+	Metadata     OCSFMetadata     `json:"metadata"`
+	Cloud        OCSFCloud        `json:"cloud"`
+	Actor        OCSFActor        `json:"actor"`
+	FindingInfo  OCSFFindingInfo  `json:"finding_info"`
+	Compliance   OCSFCompliance   `json:"compliance"`
+	Resources    []OCSFResource   `json:"resources"`
+	Remediation  *OCSFRemediation `json:"remediation,omitempty"`
+}
+
+type OCSFMetadata struct {
+	Version  string      `json:"version"`
+	Profiles []string    `json:"profiles"`
+	Product  OCSFProduct `json:"product"`
+}
+
+type OCSFProduct struct {
+	Name       string `json:"name"`
+	VendorName string `json:"vendor_name"`
+	Version    string `json:"version,omitempty"`
+	URLString  string `json:"url_string"`
+}
+
+type OCSFCloud struct {
+	Provider string      `json:"provider"`
+	Region   string      `json:"region"`
+	Account  OCSFAccount `json:"account"`
+}
+
+type OCSFAccount struct {
+	UID    string `json:"uid"`
+	Name   string `json:"name,omitempty"`
+	Type   string `json:"type"`
+	TypeID int    `json:"type_id"`
+}
+
+// OCSFActor is the principal that ran the scan, as returned by GetCallerIdentity.
+type OCSFActor struct {
+	User OCSFUser `json:"user"`
+}
+
+type OCSFUser struct {
+	UID     string       `json:"uid"`
+	Name    string       `json:"name,omitempty"`
+	Account *OCSFAccount `json:"account,omitempty"`
+}
+
+type OCSFFindingInfo struct {
+	UID         string   `json:"uid"`
+	Title       string   `json:"title"`
+	Desc        string   `json:"desc"`
+	Types       []string `json:"types"`
+	CreatedTime int64    `json:"created_time"`
+}
+
+type OCSFCompliance struct {
+	StatusID  int      `json:"status_id"`
+	Status    string   `json:"status"`
+	Control   string   `json:"control"`
+	Standards []string `json:"standards"`
+}
+
+type OCSFResource struct {
+	UID            string            `json:"uid"`
+	Name           string            `json:"name,omitempty"`
+	Type           string            `json:"type"`
+	Region         string            `json:"region"`
+	CloudPartition string            `json:"cloud_partition"`
+	Owner          *OCSFUser         `json:"owner,omitempty"`
+	Labels         []string          `json:"labels,omitempty"`
+	Data           map[string]string `json:"data,omitempty"`
+}
+
+type OCSFRemediation struct {
+	Desc       string   `json:"desc"`
+	References []string `json:"references"`
+}
+
+// NewOCSFFindings returns an OCSF Compliance Finding for each instance, with the instance and the AMI it was
+// launched from as resources. Instances on verified, self-hosted, trusted or allowed AMIs pass; the others are
+// warnings or failures.
+func NewOCSFFindings(result *scanner.Result, opts Options) []OCSFFinding {
+	timestamp := result.ScannedAt.UnixMilli()
+	callerAccount := OCSFAccount{UID: result.Identity.Account, Type: "AWS Account", TypeID: ocsfAccountTypeAWS}
+
+	findings := []OCSFFinding{}
+	for _, ami := range result.AMIs() {
+		outcome, ok := ocsfOutcomes[ami.Status]
+		if !ok {
+			continue
+		}
+		for _, instance := range result.Instances(ami) {
+			scannedAccount := OCSFAccount{UID: instance.Account, Type: "AWS Account", TypeID: ocsfAccountTypeAWS}
+			finding := OCSFFinding{
+				ActivityID:   ocsfActivityCreate,
+				ActivityName: "Create",
+				CategoryUID:  ocsfCategoryFindings,
+				CategoryName: "Findings",
+				ClassUID:     ocsfClassComplianceFinding,
+				ClassName:    "Compliance Finding",
+				TypeUID:      ocsfClassComplianceFinding*100 + ocsfActivityCreate,
+				TypeName:     "Compliance Finding: Create",
+				Time:         timestamp,
+				SeverityID:   outcome.severityID,
+				Severity:     outcome.severity,
+				StatusID:     ocsfStatusNew,
+				Status:       "New",
+				Message:      findingMessage(ami, instance),
+				Metadata: OCSFMetadata{
+					Version:  ocsfVersion,
+					Profiles: []string{"cloud"},
+					Product: OCSFProduct{
+						Name:       toolName,
+						VendorName: "Datadog",
+						Version:    opts.ToolVersion,
+						URLString:  toolURI,
+					},
+				},
+				Cloud: OCSFCloud{Provider: "AWS", Region: instance.Region, Account: scannedAccount},
+				Actor: OCSFActor{User: OCSFUser{UID: result.Identity.Arn, Account: &callerAccount}},
+				FindingInfo: OCSFFindingInfo{
+					UID:         findingID(instance.Region, instance.ID, ami.ID),
+					Title:       fmt.Sprintf("EC2 instance launched from a %s AMI", ami.Status.Code()),
+					Desc:        ami.Reason,
+					Types:       []string{"AMI provenance"},
+					CreatedTime: timestamp,
+				},
+				Compliance: OCSFCompliance{
+					StatusID:  outcome.complianceID,
+					Status:    outcome.compliance,
+					Control:   ocsfComplianceControlPrefix + ami.Status.Code(),
+					Standards: []string{ocsfComplianceStandard},
+				},
+				Resources: []OCSFResource{
+					{
+						UID:            instanceARN(result.Identity, instance),
+						Name:           instance.Name,
+						Type:           "AwsEc2Instance",
+						Region:         instance.Region,
+						CloudPartition: result.Identity.Partition(),
+						Owner:          &OCSFUser{UID: instance.Account, Account: &scannedAccount},
+						Data:           map[string]string{"instance_id": instance.ID, "image_id": ami.ID},
+					},
+					{
+						UID:            amiARN(result.Identity, ami),
+						Name:           ami.Name,
+						Type:           "AwsEc2Image",
+						Region:         ami.Region,
+						CloudPartition: result.Identity.Partition(),
+						Owner:          amiOwner(ami),
+						Labels:         []string{ami.Public},
+						Data: map[string]string{
+							"image_id":      ami.ID,
+							"description":   ami.Description,
+							"whoami_status": ami.Status.Code(),
+						},
+					},
+				},
+			}
+			if outcome != ocsfPass {
+				finding.Remediation = &OCSFRemediation{
+					Desc: "Replace the AMI with one from a verified account, or if you trust its owner, add the owner " +
+						"to your Allowed AMIs settings or pass it to --trusted-accounts.",
+					References: []string{allowedAMIsURI},
+				}
+			}
+			findings = append(findings, finding)
+		}
+	}
+	return findings
+}
+
+// amiOwner describes the account that owns an AMI, named after its owner alias or known vendor name when there is one.
+func amiOwner(ami scanner.AMI) *OCSFUser {
+	account := &OCSFAccount{UID: ami.OwnerID, Type: "AWS Account", TypeID: ocsfAccountTypeAWS}
+	if ami.OwnerName != "" && ami.OwnerName != scanner.AmiOwnerNameUnknown {
+		account.Name = ami.OwnerName
+	}
+	owner := &OCSFUser{UID: ami.OwnerID, Name: ami.OwnerAlias, Account: account}
+	if owner.Name == "" {
+		owner.Name = account.Name
+	}
+	return owner
+}
+
+// WriteOCSF writes the findings from NewOCSFFindings as JSON Lines, one event per line, ready to be ingested by OCSF
+// pipelines such as Amazon Security Lake custom sources.
+func WriteOCSF(w io.Writer, result *scanner.Result, opts Options) error {
+	encoder := json.NewEncoder(w)
+	for _, finding := range NewOCSFFindings(result, opts) {
+		if err := encoder.Encode(finding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
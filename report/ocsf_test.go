@@ -0,0 +1,66 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteOCSF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write("ocsf", &buf, testResult(), Options{ToolVersion: "1.2.3"}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var findings []OCSFFinding
+	lines := bufio.NewScanner(&buf)
+	for lines.Scan() {
+		var finding OCSFFinding
+		if err := json.Unmarshal(lines.Bytes(), &finding); err != nil {
+			t.Fatalf("line is not a JSON event: %v\n%s", err, lines.Text())
+		}
+		findings = append(findings, finding)
+	}
+	if len(findings) != 5 {
+		t.Fatalf("got %d events, want one per instance", len(findings))
+	}
+
+	want := []struct {
+		instance   string
+		compliance string
+		severityID int
+	}{
+		{"i-allowed", "Pass", 1},
+		{"i-verified", "Pass", 1},
+		{"i-shared", "Warning", 3},
+		{"i-unverified-1", "Fail", 4},
+		{"i-unverified-2", "Fail", 4},
+	}
+	for i, w := range want {
+		got := findings[i]
+		if got.ClassUID != 2003 || got.TypeUID != 200301 || got.CategoryUID != 2 {
+			t.Errorf("event %d has class %d, type %d, category %d", i, got.ClassUID, got.TypeUID, got.CategoryUID)
+		}
+		if got.Resources[0].Data["instance_id"] != w.instance || got.Compliance.Status != w.compliance ||
+			got.SeverityID != w.severityID {
+			t.Errorf("event %d = %s (%s, severity %d), want %s (%s, severity %d)", i,
+				got.Resources[0].Data["instance_id"], got.Compliance.Status, got.SeverityID, w.instance, w.compliance,
+				w.severityID)
+		}
+		if got.Actor.User.UID != "arn:aws:iam::111111111111:user/scanner" || got.Cloud.Account.UID != "111111111111" {
+			t.Errorf("event %d actor = %+v, cloud = %+v", i, got.Actor, got.Cloud)
+		}
+	}
+
+	verified := findings[1]
+	if owner := verified.Resources[1].Owner; owner.UID != "137112412989" || owner.Name != "amazon" {
+		t.Errorf("AMI owner = %+v", owner)
+	}
+	if verified.Cloud.Region != "us-east-1" || verified.Time != testResult().ScannedAt.UnixMilli() {
+		t.Errorf("region = %s, time = %d", verified.Cloud.Region, verified.Time)
+	}
+	if findings[0].Remediation != nil || findings[3].Remediation == nil {
+		t.Error("only warnings and failures should have a remediation")
+	}
+}
@@ -0,0 +1,84 @@
+// Package report renders scan results in machine-readable formats.
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+// Options holds settings shared by the report writers.
+type Options struct {
+	// ToolVersion is the version of whoAMI-scanner that produced the report
+	ToolVersion string
+	// Delimiter separates fields in CSV reports. Defaults to DefaultDelimiter.
+	Delimiter rune
+	// SecurityHubRegion is the region ASFF findings are imported into. Defaults to DefaultSecurityHubRegion.
+	SecurityHubRegion string
+	// MarkdownMaxLength is the maximum length of Markdown reports, in characters. Defaults to
+	// DefaultMarkdownMaxLength.
+	MarkdownMaxLength int
+	// FindingsCreatedAt holds the CreatedAt of ASFF findings imported by earlier scans, keyed by finding ID. Findings
+	// reported again keep it, so Security Hub shows when the instance was first found using the AMI.
+	FindingsCreatedAt map[string]string
+}
+
+// WriterFunc renders a scan result to w.
+type WriterFunc func(w io.Writer, result *scanner.Result, opts Options) error
+
+var writers = map[string]WriterFunc{
+	"asff":     WriteASFF,
+	"csv":      WriteCSV,
+	"html":     WriteHTML,
+	"json":     WriteJSON,
+	"junit":    WriteJUnit,
+	"markdown": WriteMarkdown,
+	"ocsf":     WriteOCSF,
+	"sarif":    WriteSARIF,
+}
+
+// Formats returns the names of the supported report formats, sorted.
+func Formats() []string {
+	var formats []string
+	for format := range writers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Write renders a scan result to w in the named format.
+func Write(format string, w io.Writer, result *scanner.Result, opts Options) error {
+	writer, ok := writers[format]
+	if !ok {
+		return fmt.Errorf("unknown report format %q (supported formats: %v)", format, Formats())
+	}
+	return writer(w, result, opts)
+}
+
+// regionLabels returns the display names of regions, see scanner.Result.RegionLabel.
+func regionLabels(result *scanner.Result, regions []scanner.RegionKey) []string {
+	labels := make([]string, 0, len(regions))
+	for _, region := range regions {
+		labels = append(labels, result.RegionLabel(region))
+	}
+	return labels
+}
+
+// findingMessage describes an instance launched from an AMI and the AMI's status, for the findings of every format.
+func findingMessage(ami scanner.AMI, instance scanner.Instance) string {
+	name := ""
+	if instance.Name != "" {
+		name = fmt.Sprintf(" (%s)", instance.Name)
+	}
+	return fmt.Sprintf("Instance %s%s in %s of account %s was launched from AMI %s (%s) owned by %s, which is %s: %s",
+		instance.ID, name, instance.Region, instance.Account, ami.ID, ami.Name, ami.OwnerID, ami.Status.Code(), ami.Reason)
+}
+
+// findingID returns the stable ID of the finding for an instance launched from an AMI. It is the ID of the ASFF
+// finding, so rescanning updates the findings imported into Security Hub.
+func findingID(region, instanceID, amiID string) string {
+	return fmt.Sprintf("%s%s/%s/%s", asffGeneratorPrefix, region, instanceID, amiID)
+}
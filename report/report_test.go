@@ -0,0 +1,82 @@
+package report
+
+import (
+	"errors"
+	"time"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+// testAccount is the account scanned by testResult.
+const testAccount = "111111111111"
+
+// testResult returns a scan result of two regions with an AMI of most statuses.
+func testResult() *scanner.Result {
+	usEast1 := scanner.RegionKey{Account: testAccount, Region: "us-east-1"}
+	euWest1 := scanner.RegionKey{Account: testAccount, Region: "eu-west-1"}
+	result := &scanner.Result{
+		Identity:  scanner.Identity{Account: testAccount, Arn: "arn:aws:iam::111111111111:user/scanner"},
+		Accounts:  []string{testAccount},
+		Regions:   []scanner.RegionKey{usEast1, euWest1},
+		ScannedAt: time.Date(2025, 2, 12, 10, 0, 0, 0, time.UTC),
+		AllowedAMIStateByRegion: map[scanner.RegionKey]string{
+			usEast1: "enabled",
+			euWest1: "disabled",
+		},
+		AllowedAMIAccountsByRegion: map[scanner.RegionKey][]string{
+			usEast1: {"333333333333"},
+		},
+		Errors: []scanner.ScanError{{
+			Account:   testAccount,
+			Region:    "eu-west-1",
+			Operation: "DescribeInstanceImageMetadata",
+			Resources: []string{"ami-lost"},
+			Err:       errors.New("throttled"),
+		}},
+		TotalInstances:         5,
+		ProcessedAMIs:          make(map[scanner.AMIKey]bool),
+		AMIToInstances:         make(map[scanner.AMIKey][]scanner.Instance),
+		VerifiedAMIs:           make(map[scanner.AMIKey]scanner.AMI),
+		SelfHostedAMIs:         make(map[scanner.AMIKey]scanner.AMI),
+		AllowedAMIs:            make(map[scanner.AMIKey]scanner.AMI),
+		TrustedAMIs:            make(map[scanner.AMIKey]scanner.AMI),
+		PrivateSharedAMIs:      make(map[scanner.AMIKey]scanner.AMI),
+		UnverifiedButKnownAMIs: make(map[scanner.AMIKey]scanner.AMI),
+		UnverifiedAMIs:         make(map[scanner.AMIKey]scanner.AMI),
+	}
+
+	add := func(categories map[scanner.AMIKey]scanner.AMI, ami scanner.AMI, instances ...scanner.Instance) {
+		ami.Account = testAccount
+		ami.OwnerName = scanner.AmiOwnerNameUnknown
+		if ami.Public == "" {
+			ami.Public = "Public"
+		}
+		for i := range instances {
+			instances[i].Account = testAccount
+		}
+		categories[ami.Key()] = ami
+		result.ProcessedAMIs[ami.Key()] = true
+		result.AMIToInstances[ami.Key()] = instances
+	}
+	add(result.VerifiedAMIs, scanner.AMI{
+		ID: "ami-verified", Region: "us-east-1", OwnerAlias: "amazon", OwnerID: "137112412989",
+		Name: "al2023-ami", Status: scanner.StatusVerified, Reason: "verified",
+	}, scanner.Instance{ID: "i-verified", Region: "us-east-1", Name: "web"})
+	add(result.AllowedAMIs, scanner.AMI{
+		ID: "ami-allowed", Region: "us-east-1", OwnerID: "333333333333", Name: "golden",
+		Status: scanner.StatusAllowed, Reason: "allowed",
+	}, scanner.Instance{ID: "i-allowed", Region: "us-east-1"})
+	add(result.PrivateSharedAMIs, scanner.AMI{
+		ID: "ami-shared", Region: "eu-west-1", OwnerID: "444444444444", Name: "shared", Public: "Private",
+		Status: scanner.StatusPrivateShared, Reason: "privately shared by 444444444444",
+	}, scanner.Instance{ID: "i-shared", Region: "eu-west-1", Name: "db"})
+	add(result.UnverifiedAMIs, scanner.AMI{
+		ID: "ami-unverified", Region: "eu-west-1", OwnerID: "222222222222", Name: "ubuntu|jammy",
+		Description: "line one\nline \"two\"", Status: scanner.StatusUnverified, Reason: "owner 222222222222 is unverified",
+	},
+		scanner.Instance{ID: "i-unverified-1", Region: "eu-west-1", Name: "worker, blue"},
+		scanner.Instance{ID: "i-unverified-2", Region: "eu-west-1"},
+	)
+	result.ProcessedAMIs[scanner.AMIKey{Account: testAccount, Region: "eu-west-1", ID: "ami-lost"}] = true
+	return result
+}
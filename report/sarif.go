@@ -0,0 +1,222 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+)
+
+const (
+	sarifVersion   = "2.1.0"
+	sarifSchema    = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolName       = "whoAMI-scanner"
+	toolURI        = "https://github.com/DataDog/whoAMI-scanner"
+	allowedAMIsURI = "https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/ec2-allowed-amis.html"
+)
+
+// sarifRule describes the SARIF rule reported for instances launched from AMIs of a whoAMI status. The level
+// follows the colour of the status in the summary key: red is an error and yellow a warning.
+type sarifRule struct {
+	status           scanner.Status
+	level            string
+	securitySeverity string
+	short            string
+	full             string
+}
+
+var sarifRules = []sarifRule{
+	{
+		status:           scanner.StatusPrivateShared,
+		level:            "warning",
+		securitySeverity: "5.0",
+		short:            "Instance launched from a privately shared AMI",
+		full: "The AMI is shared privately with this account but is not from a verified, trusted or allowed " +
+			"account. If you trust the owner, add it to your Allowed AMIs settings or pass it to --trusted-accounts.",
+	},
+	{
+		status:           scanner.StatusUnknown,
+		level:            "warning",
+		securitySeverity: "5.0",
+		short:            "Instance launched from an AMI with an unrecognized owner alias",
+		full: "The AMI has an owner alias that whoAMI-scanner does not recognize, so whether its owner can be " +
+			"trusted is unknown.",
+	},
+	{
+		status:           scanner.StatusUnverifiedButKnown,
+		level:            "warning",
+		securitySeverity: "5.0",
+		short:            "Instance launched from a public AMI of an unverified but known account",
+		full: "The AMI is public and owned by an unverified account that is listed in fwdcloudsec's " +
+			"known_aws_accounts mapping. It is likely safe to use but worth investigating.",
+	},
+	{
+		status:           scanner.StatusUnverified,
+		level:            "error",
+		securitySeverity: "8.0",
+		short:            "Instance launched from a public AMI of an unverified account",
+		full: "The AMI is public and owned by an unverified, unknown account. Unless the account is yours, " +
+			"replace it with an AMI from a verified account.",
+	},
+}
+
+// sarifRuleID returns the SARIF rule ID for instances launched from AMIs of the given status.
+func sarifRuleID(status scanner.Status) string {
+	return "whoami/" + status.Code()
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	Invocations []sarifInvocation `json:"invocations"`
+	Results     []sarifResult     `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string                `json:"name"`
+	Version        string                `json:"version,omitempty"`
+	InformationURI string                `json:"informationUri"`
+	Rules          []sarifRuleDescriptor `json:"rules"`
+}
+
+type sarifRuleDescriptor struct {
+	ID                   string         `json:"id"`
+	Name                 string         `json:"name"`
+	ShortDescription     sarifMessage   `json:"shortDescription"`
+	FullDescription      sarifMessage   `json:"fullDescription"`
+	HelpURI              string         `json:"helpUri"`
+	DefaultConfiguration sarifConfig    `json:"defaultConfiguration"`
+	Properties           map[string]any `json:"properties"`
+}
+
+type sarifConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	StartTimeUTC               string              `json:"startTimeUtc,omitempty"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level   string       `json:"level"`
+	Message sarifMessage `json:"message"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+	Properties          map[string]any    `json:"properties"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// WriteSARIF writes a SARIF 2.1.0 log with one result per instance launched from a privately shared,
+// unverified-but-known or unverified AMI. Each result's logical locations are the instance, the AMI and the region.
+func WriteSARIF(w io.Writer, result *scanner.Result, opts Options) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           toolName,
+			Version:        opts.ToolVersion,
+			InformationURI: toolURI,
+			Rules:          []sarifRuleDescriptor{},
+		}},
+		Invocations: []sarifInvocation{{ExecutionSuccessful: !result.Incomplete()}},
+		Results:     []sarifResult{},
+	}
+	if !result.ScannedAt.IsZero() {
+		run.Invocations[0].StartTimeUTC = result.ScannedAt.UTC().Format("2006-01-02T15:04:05Z")
+	}
+	for _, scanErr := range result.Errors {
+		run.Invocations[0].ToolExecutionNotifications = append(run.Invocations[0].ToolExecutionNotifications,
+			sarifNotification{Level: "error", Message: sarifMessage{Text: scanErr.Error()}})
+	}
+
+	ruleIndex := make(map[scanner.Status]int)
+	for i, rule := range sarifRules {
+		ruleIndex[rule.status] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRuleDescriptor{
+			ID:                   sarifRuleID(rule.status),
+			Name:                 rule.status.String(),
+			ShortDescription:     sarifMessage{Text: rule.short},
+			FullDescription:      sarifMessage{Text: rule.full},
+			HelpURI:              allowedAMIsURI,
+			DefaultConfiguration: sarifConfig{Level: rule.level},
+			Properties: map[string]any{
+				"tags":              []string{"security", "supply-chain"},
+				"security-severity": rule.securitySeverity,
+			},
+		})
+	}
+
+	for _, ami := range result.AMIs() {
+		index, ok := ruleIndex[ami.Status]
+		if !ok {
+			continue
+		}
+		for _, instance := range result.Instances(ami) {
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    sarifRuleID(ami.Status),
+				RuleIndex: index,
+				Level:     sarifRules[index].level,
+				Message:   sarifMessage{Text: findingMessage(ami, instance)},
+				Locations: []sarifLocation{{LogicalLocations: []sarifLogicalLocation{
+					{
+						Name:               instance.ID,
+						FullyQualifiedName: instanceARN(result.Identity, instance),
+						Kind:               "resource",
+					},
+					{Name: ami.ID, FullyQualifiedName: amiARN(result.Identity, ami), Kind: "resource"},
+					{Name: ami.Region, FullyQualifiedName: ami.Region, Kind: "namespace"},
+				}}},
+				PartialFingerprints: map[string]string{
+					"instanceAmi/v1": fmt.Sprintf("%s/%s/%s", instance.Region, instance.ID, ami.ID),
+				},
+				Properties: map[string]any{
+					"ownerId":   ami.OwnerID,
+					"ownerName": ami.OwnerName,
+					"amiName":   ami.Name,
+				},
+			})
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Version: sarifVersion, Schema: sarifSchema, Runs: []sarifRun{run}})
+}
+
+func instanceARN(identity scanner.Identity, instance scanner.Instance) string {
+	return fmt.Sprintf("arn:%s:ec2:%s:%s:instance/%s", identity.Partition(), instance.Region, instance.Account, instance.ID)
+}
+
+func amiARN(identity scanner.Identity, ami scanner.AMI) string {
+	return fmt.Sprintf("arn:%s:ec2:%s::image/%s", identity.Partition(), ami.Region, ami.ID)
+}
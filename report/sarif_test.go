@@ -0,0 +1,55 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write("sarif", &buf, testResult(), Options{ToolVersion: "1.2.3"}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("report is not valid JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("version = %q with %d runs, want one 2.1.0 run", log.Version, len(log.Runs))
+	}
+	run := log.Runs[0]
+	if len(run.Tool.Driver.Rules) != 4 {
+		t.Errorf("got %d rules, want one per reported status", len(run.Tool.Driver.Rules))
+	}
+	if run.Invocations[0].ExecutionSuccessful || len(run.Invocations[0].ToolExecutionNotifications) != 1 {
+		t.Errorf("invocation = %+v, want an unsuccessful execution with one notification", run.Invocations[0])
+	}
+
+	// Verified and allowed AMIs are not findings
+	want := []struct {
+		ruleID, level, instance string
+	}{
+		{"whoami/private-shared", "warning", "i-shared"},
+		{"whoami/unverified", "error", "i-unverified-1"},
+		{"whoami/unverified", "error", "i-unverified-2"},
+	}
+	if len(run.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(run.Results), len(want))
+	}
+	for i, w := range want {
+		got := run.Results[i]
+		if got.RuleID != w.ruleID || got.Level != w.level || run.Tool.Driver.Rules[got.RuleIndex].ID != w.ruleID {
+			t.Errorf("result %d = %s (%s, rule index %d), want %s (%s)", i, got.RuleID, got.Level, got.RuleIndex,
+				w.ruleID, w.level)
+		}
+		locations := got.Locations[0].LogicalLocations
+		if len(locations) != 3 || locations[0].Name != w.instance || locations[2].Name != "eu-west-1" {
+			t.Errorf("result %d locations = %+v", i, locations)
+		}
+	}
+	if got := run.Results[1].Locations[0].LogicalLocations[0].FullyQualifiedName; got != "arn:aws:ec2:eu-west-1:111111111111:instance/i-unverified-1" {
+		t.Errorf("instance fully qualified name = %q", got)
+	}
+}
@@ -0,0 +1,244 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/DataDog/whoAMI-scanner/scanner"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/securityhub"
+	"github.com/aws/aws-sdk-go-v2/service/securityhub/types"
+)
+
+// securityHubBatchSize is the maximum number of findings BatchImportFindings accepts per call.
+const securityHubBatchSize = 100
+
+// SecurityHubAPI is the subset of the Security Hub API used to publish findings.
+type SecurityHubAPI interface {
+	BatchImportFindings(ctx context.Context, params *securityhub.BatchImportFindingsInput, optFns ...func(*securityhub.Options)) (*securityhub.BatchImportFindingsOutput, error)
+	GetFindings(ctx context.Context, params *securityhub.GetFindingsInput, optFns ...func(*securityhub.Options)) (*securityhub.GetFindingsOutput, error)
+}
+
+var _ SecurityHubAPI = (*securityhub.Client)(nil)
+
+// PublishSummary counts the findings imported into Security Hub by PublishSecurityHub.
+type PublishSummary struct {
+	// Imported is the number of findings created or updated for AMIs in use
+	Imported int
+	// Archived is the number of findings from earlier scans that were archived because the instance no longer uses
+	// the AMI, or the AMI is no longer risky
+	Archived int
+}
+
+// PublishSecurityHub imports the findings from NewASFFFindings into Security Hub. Active findings from earlier scans
+// of the same account that are not reported anymore are archived. Findings in regions that were
+// not scanned or whose scan was incomplete are left untouched, since they may still be accurate.
+func PublishSecurityHub(ctx context.Context, client SecurityHubAPI, result *scanner.Result, opts Options) (PublishSummary, error) {
+	var summary PublishSummary
+	existing, err := activeFindings(ctx, client, result)
+	if err != nil {
+		return summary, err
+	}
+	// Findings reported again keep the time they were first detected
+	opts.FindingsCreatedAt = make(map[string]string, len(existing))
+	for _, finding := range existing {
+		opts.FindingsCreatedAt[aws.ToString(finding.Id)] = aws.ToString(finding.CreatedAt)
+	}
+	findings := NewASFFFindings(result, opts)
+
+	current := make(map[string]bool)
+	for _, finding := range findings {
+		current[finding.Id] = true
+	}
+	stale := staleFindings(result, existing, current)
+
+	if err := importFindings(ctx, client, findings); err != nil {
+		return summary, err
+	}
+	summary.Imported = len(findings)
+
+	if err := importFindings(ctx, client, stale); err != nil {
+		return summary, err
+	}
+	summary.Archived = len(stale)
+	return summary, nil
+}
+
+// activeFindings returns the active findings previously imported for the scanned accounts.
+func activeFindings(ctx context.Context, client SecurityHubAPI, result *scanner.Result) ([]types.AwsSecurityFinding, error) {
+	equals := func(value string) types.StringFilter {
+		return types.StringFilter{Comparison: types.StringFilterComparisonEquals, Value: aws.String(value)}
+	}
+	// Filters take a limited number of values, so the findings of several accounts are only told apart by eligible
+	var accountFilter []types.StringFilter
+	if len(result.Accounts) == 1 {
+		accountFilter = []types.StringFilter{equals(result.Accounts[0])}
+	}
+	paginator := securityhub.NewGetFindingsPaginator(client, &securityhub.GetFindingsInput{
+		Filters: &types.AwsSecurityFindingFilters{
+			AwsAccountId: accountFilter,
+			GeneratorId: []types.StringFilter{{
+				Comparison: types.StringFilterComparisonPrefix,
+				Value:      aws.String(asffGeneratorPrefix),
+			}},
+			RecordState:    []types.StringFilter{equals(string(types.RecordStateActive))},
+			WorkflowStatus: []types.StringFilter{equals(string(types.WorkflowStatusNew)), equals(string(types.WorkflowStatusNotified))},
+		},
+	})
+
+	var findings []types.AwsSecurityFinding
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing existing Security Hub findings: %w", err)
+		}
+		for _, finding := range page.Findings {
+			if strings.HasPrefix(aws.ToString(finding.Id), asffGeneratorPrefix) {
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings, nil
+}
+
+// staleFindings returns the existing findings that are not in current, rewritten to be archived.
+func staleFindings(result *scanner.Result, existing []types.AwsSecurityFinding, current map[string]bool) []ASFFFinding {
+	eligible := make(map[scanner.RegionKey]bool)
+	for _, region := range result.Regions {
+		eligible[region] = true
+	}
+	for _, region := range result.IncompleteRegions() {
+		eligible[region] = false
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	var stale []ASFFFinding
+	for _, finding := range existing {
+		if current[aws.ToString(finding.Id)] || !eligible[findingRegion(finding)] {
+			continue
+		}
+		stale = append(stale, archivedFinding(finding, now))
+	}
+	return stale
+}
+
+// findingRegion returns the account and region of the instance a finding was reported for.
+func findingRegion(finding types.AwsSecurityFinding) scanner.RegionKey {
+	for _, resource := range finding.Resources {
+		if aws.ToString(resource.Type) == "AwsEc2Instance" {
+			return scanner.RegionKey{Account: aws.ToString(finding.AwsAccountId), Region: aws.ToString(resource.Region)}
+		}
+	}
+	return scanner.RegionKey{}
+}
+
+// archivedFinding rebuilds an existing finding with its record state archived. BatchImportFindings ignores the
+// workflow status of existing findings, so it is left as is for the user to resolve.
+func archivedFinding(finding types.AwsSecurityFinding, now string) ASFFFinding {
+	archived := ASFFFinding{
+		SchemaVersion: aws.ToString(finding.SchemaVersion),
+		Id:            aws.ToString(finding.Id),
+		ProductArn:    aws.ToString(finding.ProductArn),
+		GeneratorId:   aws.ToString(finding.GeneratorId),
+		AwsAccountId:  aws.ToString(finding.AwsAccountId),
+		Types:         finding.Types,
+		CreatedAt:     aws.ToString(finding.CreatedAt),
+		UpdatedAt:     now,
+		Title:         aws.ToString(finding.Title),
+		Description:   aws.ToString(finding.Description),
+		SourceUrl:     aws.ToString(finding.SourceUrl),
+		ProductFields: finding.ProductFields,
+		RecordState:   string(types.RecordStateArchived),
+	}
+	if finding.Severity != nil {
+		archived.Severity.Label = string(finding.Severity.Label)
+	}
+	if finding.Workflow != nil {
+		archived.Workflow.Status = string(finding.Workflow.Status)
+	}
+	for _, resource := range finding.Resources {
+		r := ASFFResource{
+			Type:      aws.ToString(resource.Type),
+			Id:        aws.ToString(resource.Id),
+			Partition: string(resource.Partition),
+			Region:    aws.ToString(resource.Region),
+			Tags:      resource.Tags,
+		}
+		if details := resource.Details; details != nil {
+			r.Details = &ASFFDetails{Other: details.Other}
+			if details.AwsEc2Instance != nil {
+				r.Details.AwsEc2Instance = &ASFFInstanceDetails{ImageId: aws.ToString(details.AwsEc2Instance.ImageId)}
+			}
+		}
+		archived.Resources = append(archived.Resources, r)
+	}
+	return archived
+}
+
+// importFindings calls BatchImportFindings in batches and fails if any finding is rejected.
+func importFindings(ctx context.Context, client SecurityHubAPI, findings []ASFFFinding) error {
+	for start := 0; start < len(findings); start += securityHubBatchSize {
+		end := min(start+securityHubBatchSize, len(findings))
+		var batch []types.AwsSecurityFinding
+		for _, finding := range findings[start:end] {
+			batch = append(batch, finding.toSecurityHub())
+		}
+
+		output, err := client.BatchImportFindings(ctx, &securityhub.BatchImportFindingsInput{Findings: batch})
+		if err != nil {
+			return fmt.Errorf("importing findings into Security Hub: %w", err)
+		}
+		if len(output.FailedFindings) > 0 {
+			failed := output.FailedFindings[0]
+			return fmt.Errorf("Security Hub rejected %d findings, first %s: %s: %s", len(output.FailedFindings),
+				aws.ToString(failed.Id), aws.ToString(failed.ErrorCode), aws.ToString(failed.ErrorMessage))
+		}
+	}
+	return nil
+}
+
+// toSecurityHub converts the finding to the Security Hub API type.
+func (f ASFFFinding) toSecurityHub() types.AwsSecurityFinding {
+	finding := types.AwsSecurityFinding{
+		SchemaVersion: aws.String(f.SchemaVersion),
+		Id:            aws.String(f.Id),
+		ProductArn:    aws.String(f.ProductArn),
+		GeneratorId:   aws.String(f.GeneratorId),
+		AwsAccountId:  aws.String(f.AwsAccountId),
+		Types:         f.Types,
+		CreatedAt:     aws.String(f.CreatedAt),
+		UpdatedAt:     aws.String(f.UpdatedAt),
+		Severity:      &types.Severity{Label: types.SeverityLabel(f.Severity.Label)},
+		Title:         aws.String(f.Title),
+		Description:   aws.String(f.Description),
+		ProductFields: f.ProductFields,
+		RecordState:   types.RecordState(f.RecordState),
+	}
+	if f.Workflow.Status != "" {
+		finding.Workflow = &types.Workflow{Status: types.WorkflowStatus(f.Workflow.Status)}
+	}
+	if f.SourceUrl != "" {
+		finding.SourceUrl = aws.String(f.SourceUrl)
+	}
+	for _, resource := range f.Resources {
+		r := types.Resource{
+			Type:      aws.String(resource.Type),
+			Id:        aws.String(resource.Id),
+			Partition: types.Partition(resource.Partition),
+			Region:    aws.String(resource.Region),
+			Tags:      resource.Tags,
+		}
+		if resource.Details != nil {
+			r.Details = &types.ResourceDetails{Other: resource.Details.Other}
+			if resource.Details.AwsEc2Instance != nil {
+				r.Details.AwsEc2Instance = &types.AwsEc2InstanceDetails{
+					ImageId: aws.String(resource.Details.AwsEc2Instance.ImageId),
+				}
+			}
+		}
+		finding.Resources = append(finding.Resources, r)
+	}
+	return finding
+}
@@ -0,0 +1,123 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/securityhub"
+)
+
+// securityHubStub is a local Security Hub endpoint that serves existingFindings to GetFindings and records the
+// findings passed to BatchImportFindings.
+type securityHubStub struct {
+	mu               sync.Mutex
+	existingFindings []map[string]any
+	imported         [][]map[string]any
+}
+
+func (s *securityHubStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/findings":
+		json.NewEncoder(w).Encode(map[string]any{"Findings": s.existingFindings})
+	case "/findings/import":
+		var input struct {
+			Findings []map[string]any
+		}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.imported = append(s.imported, input.Findings)
+		json.NewEncoder(w).Encode(map[string]any{"SuccessCount": len(input.Findings), "FailedCount": 0})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func existingFinding(region, instanceID, amiID string) map[string]any {
+	return map[string]any{
+		"SchemaVersion": asffSchemaVersion,
+		"Id":            findingID(region, instanceID, amiID),
+		"ProductArn":    "arn:aws:securityhub:us-east-1:111111111111:product/111111111111/default",
+		"GeneratorId":   asffGeneratorPrefix + "unverified",
+		"AwsAccountId":  "111111111111",
+		"Types":         []string{"Software and Configuration Checks/AWS Security Best Practices"},
+		"CreatedAt":     "2025-01-01T00:00:00Z",
+		"UpdatedAt":     "2025-01-01T00:00:00Z",
+		"Severity":      map[string]any{"Label": "HIGH"},
+		"Title":         "EC2 instance launched from a unverified AMI",
+		"Description":   "old finding",
+		"ProductFields": map[string]string{"whoami-scanner/Status": "unverified"},
+		"Resources": []map[string]any{{
+			"Type":    "AwsEc2Instance",
+			"Id":      "arn:aws:ec2:" + region + ":111111111111:instance/" + instanceID,
+			"Region":  region,
+			"Details": map[string]any{"AwsEc2Instance": map[string]any{"ImageId": amiID}},
+		}},
+		"RecordState": "ACTIVE",
+		"Workflow":    map[string]any{"Status": "NEW"},
+	}
+}
+
+func TestPublishSecurityHub(t *testing.T) {
+	stub := &securityHubStub{existingFindings: []map[string]any{
+		// Still reported by this scan
+		existingFinding("eu-west-1", "i-shared", "ami-shared"),
+		// No longer in use in a fully scanned region
+		existingFinding("us-east-1", "i-gone", "ami-old"),
+		// eu-west-1 is incomplete and ap-south-1 was not scanned, so these may still be accurate
+		existingFinding("eu-west-1", "i-maybe", "ami-old"),
+		existingFinding("ap-south-1", "i-other", "ami-old"),
+	}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	client := securityhub.NewFromConfig(aws.Config{
+		Region:       "us-east-1",
+		Credentials:  aws.AnonymousCredentials{},
+		BaseEndpoint: aws.String(server.URL),
+	})
+	summary, err := PublishSecurityHub(context.Background(), client, testResult(), Options{ToolVersion: "1.2.3"})
+	if err != nil {
+		t.Fatalf("PublishSecurityHub() error = %v", err)
+	}
+	if summary.Imported != 3 || summary.Archived != 1 {
+		t.Errorf("summary = %+v, want 3 imported and 1 archived", summary)
+	}
+
+	if len(stub.imported) != 2 {
+		t.Fatalf("got %d BatchImportFindings calls, want 2", len(stub.imported))
+	}
+	for _, finding := range stub.imported[0] {
+		if finding["Id"] == findingID("eu-west-1", "i-shared", "ami-shared") && finding["CreatedAt"] != "2025-01-01T00:00:00Z" {
+			t.Errorf("finding reported again was created at %v, want the CreatedAt of the existing finding", finding["CreatedAt"])
+		}
+		if finding["RecordState"] != "ACTIVE" || finding["ProductArn"] != "arn:aws:securityhub:us-east-1:111111111111:product/111111111111/default" {
+			t.Errorf("imported finding %v has record state %v and product %v", finding["Id"], finding["RecordState"],
+				finding["ProductArn"])
+		}
+	}
+	archived := stub.imported[1][0]
+	if archived["Id"] != findingID("us-east-1", "i-gone", "ami-old") || archived["RecordState"] != "ARCHIVED" {
+		t.Errorf("archived finding = %v", archived)
+	}
+	// The archived finding keeps what the earlier scan reported
+	productFields, _ := archived["ProductFields"].(map[string]any)
+	resources, _ := archived["Resources"].([]any)
+	if productFields["whoami-scanner/Status"] != "unverified" || len(resources) != 1 {
+		t.Fatalf("archived finding = %v, want the product fields and resource of the existing finding", archived)
+	}
+	details, _ := resources[0].(map[string]any)["Details"].(map[string]any)
+	if instance, _ := details["AwsEc2Instance"].(map[string]any); instance["ImageId"] != "ami-old" {
+		t.Errorf("archived finding resource details = %v, want the ImageId of the existing finding", details)
+	}
+}
@@ -0,0 +1,138 @@
+package scanner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRoleSessionName names the sessions of the roles assumed in each account when the AccountTarget does not, so
+// they stand out in CloudTrail.
+const DefaultRoleSessionName = "whoAMI-scanner"
+
+// AccountTarget is an account to scan, along with how to get credentials for it. It is read from an accounts file.
+type AccountTarget struct {
+	// ID is the 12-digit account ID
+	ID string `yaml:"id"`
+	// RoleARN is the role assumed to scan the account. When empty, the caller's default role name is used.
+	RoleARN string `yaml:"role_arn"`
+	// ExternalID is passed to sts:AssumeRole when the role's trust policy requires one
+	ExternalID string `yaml:"external_id"`
+	// SessionName is the role session name, which shows up in the account's CloudTrail
+	SessionName string `yaml:"session_name"`
+	// Regions overrides the regions scanned in this account
+	Regions []string `yaml:"regions"`
+}
+
+// accountsFile is the document read by LoadAccountsFile.
+type accountsFile struct {
+	Accounts []yaml.Node `yaml:"accounts"`
+}
+
+var (
+	accountIDPattern   = regexp.MustCompile(`^[0-9]{12}$`)
+	roleARNPattern     = regexp.MustCompile(`^arn:[a-z-]+:iam::([0-9]{12}):role/.+$`)
+	sessionNamePattern = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+)
+
+// LoadAccountsFile reads the accounts to scan from a YAML or JSON file. See ParseAccounts for the format.
+func LoadAccountsFile(path string) ([]AccountTarget, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseAccounts(path, data)
+}
+
+// ParseAccounts parses an accounts file: a YAML or JSON document with an "accounts" list, each entry having an "id"
+// and optionally a "role_arn", "external_id", "session_name" and "regions". name is used in error messages, which
+// point at the offending line.
+func ParseAccounts(name string, data []byte) ([]AccountTarget, error) {
+	var file accountsFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, yamlError(name, err)
+	}
+	if len(file.Accounts) == 0 {
+		return nil, fmt.Errorf("%s: no accounts listed", name)
+	}
+
+	var targets []AccountTarget
+	seen := make(map[string]int)
+	for _, node := range file.Accounts {
+		lineErr := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", name, node.Line, fmt.Sprintf(format, args...))
+		}
+		if err := checkFields(name, &node, "id", "role_arn", "external_id", "session_name", "regions"); err != nil {
+			return nil, err
+		}
+		var target AccountTarget
+		if err := node.Decode(&target); err != nil {
+			return nil, yamlError(name, err)
+		}
+		if !accountIDPattern.MatchString(target.ID) {
+			return nil, lineErr("account ID %q is not 12 digits", target.ID)
+		}
+		if line, ok := seen[target.ID]; ok {
+			return nil, lineErr("account %s is already listed on line %d", target.ID, line)
+		}
+		seen[target.ID] = node.Line
+		if target.RoleARN != "" {
+			match := roleARNPattern.FindStringSubmatch(target.RoleARN)
+			if match == nil {
+				return nil, lineErr("role_arn %q is not an IAM role ARN", target.RoleARN)
+			}
+			if match[1] != target.ID {
+				return nil, lineErr("role_arn %q is not in account %s", target.RoleARN, target.ID)
+			}
+		}
+		if target.SessionName != "" && !sessionNamePattern.MatchString(target.SessionName) {
+			return nil, lineErr("session_name %q must be 2 to 64 letters, digits or +=,.@_- characters", target.SessionName)
+		}
+		for _, region := range target.Regions {
+			if region == "" {
+				return nil, lineErr("empty region")
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// NewAccountScanner returns the Scanner of a target account, with credentials from sts:AssumeRole called through client
+// with the base credentials in cfg. A target without a role ARN gets the role roleName in its account, except the
+// caller's own account, which is scanned with the base credentials since an organization's management account usually
+// has no such role. The target's regions, when set, replace opts.Regions.
+func NewAccountScanner(cfg aws.Config, identity Identity, target AccountTarget, roleName string,
+	client stscreds.AssumeRoleAPIClient, opts Options) *Scanner {
+	if len(target.Regions) > 0 {
+		opts.Regions = target.Regions
+	}
+	roleARN := target.RoleARN
+	if roleARN == "" {
+		if target.ID == identity.Account {
+			return New(cfg, opts)
+		}
+		roleARN = fmt.Sprintf("arn:%s:iam::%s:role/%s", identity.Partition(), target.ID, roleName)
+	}
+	accountCfg := cfg.Copy()
+	accountCfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(client, roleARN,
+		func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = DefaultRoleSessionName
+			if target.SessionName != "" {
+				o.RoleSessionName = target.SessionName
+			}
+			if target.ExternalID != "" {
+				o.ExternalID = aws.String(target.ExternalID)
+			}
+		}))
+	return New(accountCfg, opts)
+}
@@ -0,0 +1,199 @@
+package scanner
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+)
+
+func TestParseAccounts(t *testing.T) {
+	yamlFile := `
+# Accounts outside the organization
+accounts:
+  - id: "123456789012"
+    role_arn: arn:aws:iam::123456789012:role/audit/whoAMI-scanner
+    external_id: s3cr3t
+    session_name: whoami-audit
+    regions: [us-east-1, eu-west-1]
+  - id: 012345678901
+`
+	want := []AccountTarget{
+		{
+			ID:          "123456789012",
+			RoleARN:     "arn:aws:iam::123456789012:role/audit/whoAMI-scanner",
+			ExternalID:  "s3cr3t",
+			SessionName: "whoami-audit",
+			Regions:     []string{"us-east-1", "eu-west-1"},
+		},
+		{ID: "012345678901"},
+	}
+	got, err := ParseAccounts("accounts.yaml", []byte(yamlFile))
+	if err != nil {
+		t.Fatalf("ParseAccounts() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAccounts() = %+v, want %+v", got, want)
+	}
+
+	jsonFile := `{"accounts": [{"id": "123456789012", "role_arn": "arn:aws-cn:iam::123456789012:role/scanner"}]}`
+	got, err = ParseAccounts("accounts.json", []byte(jsonFile))
+	if err != nil {
+		t.Fatalf("ParseAccounts() error = %v", err)
+	}
+	if len(got) != 1 || got[0].RoleARN != "arn:aws-cn:iam::123456789012:role/scanner" {
+		t.Errorf("ParseAccounts() = %+v", got)
+	}
+}
+
+func TestParseAccountsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{"empty", "", "accounts.yaml: no accounts listed"},
+		{"syntax", "accounts: [", "accounts.yaml:1: did not find expected node content"},
+		{"unknown top-level field", "acounts: []", "accounts.yaml:1: field acounts not found"},
+		{"short ID", "accounts:\n  - id: \"1234\"\n", `accounts.yaml:2: account ID "1234" is not 12 digits`},
+		{"unknown field", "accounts:\n  - id: \"123456789012\"\n    rol_arn: x\n", `accounts.yaml:3: unknown field "rol_arn"`},
+		{"not a mapping", "accounts:\n  - \"123456789012\"\n", "accounts.yaml:2: expected a mapping"},
+		{
+			"duplicate",
+			"accounts:\n  - id: \"123456789012\"\n  - id: \"123456789012\"\n",
+			"accounts.yaml:3: account 123456789012 is already listed on line 2",
+		},
+		{
+			"role in another account",
+			"accounts:\n  - id: \"123456789012\"\n    role_arn: arn:aws:iam::210987654321:role/scanner\n",
+			`accounts.yaml:2: role_arn "arn:aws:iam::210987654321:role/scanner" is not in account 123456789012`,
+		},
+		{
+			"not a role",
+			"accounts:\n  - id: \"123456789012\"\n    role_arn: arn:aws:iam::123456789012:user/scanner\n",
+			"is not an IAM role ARN",
+		},
+		{
+			"session name",
+			"accounts:\n  - id: \"123456789012\"\n    session_name: has spaces\n",
+			`session_name "has spaces"`,
+		},
+		{
+			"regions type",
+			"accounts:\n  - id: \"123456789012\"\n    regions: us-east-1\n",
+			"accounts.yaml:3: cannot unmarshal !!str `us-east-1` into []string",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseAccounts("accounts.yaml", []byte(tt.file))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseAccounts() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAccountScanner(t *testing.T) {
+	const member = "333333333333"
+	cfg := aws.Config{Region: testRegion, Credentials: credentials.NewStaticCredentialsProvider("AKIABASE", "secret", "")}
+	opts := Options{Regions: []string{testRegion}, Vendors: testVendors()}
+
+	tests := []struct {
+		name   string
+		arn    string
+		target AccountTarget
+		// wantRoleARN is the role assumed, or "" when the base credentials are used
+		wantRoleARN     string
+		wantSessionName string
+		wantExternalID  string
+		wantRegions     []string
+	}{
+		{
+			name:            "role name in the account",
+			arn:             "arn:aws:iam::111111111111:user/scanner",
+			target:          AccountTarget{ID: member},
+			wantRoleARN:     "arn:aws:iam::333333333333:role/OrganizationAccountAccessRole",
+			wantSessionName: DefaultRoleSessionName,
+			wantRegions:     []string{testRegion},
+		},
+		{
+			name:            "role name in the caller's partition",
+			arn:             "arn:aws-cn:iam::111111111111:user/scanner",
+			target:          AccountTarget{ID: member},
+			wantRoleARN:     "arn:aws-cn:iam::333333333333:role/OrganizationAccountAccessRole",
+			wantSessionName: DefaultRoleSessionName,
+			wantRegions:     []string{testRegion},
+		},
+		{
+			name: "role ARN, external ID, session name and regions of the target",
+			arn:  "arn:aws:iam::111111111111:user/scanner",
+			target: AccountTarget{
+				ID:          member,
+				RoleARN:     "arn:aws:iam::333333333333:role/audit/whoAMI-scanner",
+				ExternalID:  "s3cr3t",
+				SessionName: "whoami-audit",
+				Regions:     []string{"eu-west-1", "eu-central-1"},
+			},
+			wantRoleARN:     "arn:aws:iam::333333333333:role/audit/whoAMI-scanner",
+			wantSessionName: "whoami-audit",
+			wantExternalID:  "s3cr3t",
+			wantRegions:     []string{"eu-west-1", "eu-central-1"},
+		},
+		{
+			name:        "caller's account uses the base credentials",
+			arn:         "arn:aws:iam::111111111111:user/scanner",
+			target:      AccountTarget{ID: testAccount, Regions: []string{"eu-west-1"}},
+			wantRegions: []string{"eu-west-1"},
+		},
+		{
+			name:            "caller's account with a role ARN assumes it",
+			arn:             "arn:aws:iam::111111111111:user/scanner",
+			target:          AccountTarget{ID: testAccount, RoleARN: "arn:aws:iam::111111111111:role/scanner"},
+			wantRoleARN:     "arn:aws:iam::111111111111:role/scanner",
+			wantSessionName: DefaultRoleSessionName,
+			wantRegions:     []string{testRegion},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeSTS{account: testAccount}
+			identity := Identity{Account: testAccount, Arn: tt.arn}
+			s := NewAccountScanner(cfg, identity, tt.target, "OrganizationAccountAccessRole", client, opts)
+
+			creds, err := s.cfg.Credentials.Retrieve(context.Background())
+			if err != nil {
+				t.Fatalf("Retrieve() error = %v", err)
+			}
+			if !slices.Equal(s.opts.Regions, tt.wantRegions) {
+				t.Errorf("Regions = %v, want %v", s.opts.Regions, tt.wantRegions)
+			}
+			if tt.wantRoleARN == "" {
+				if len(client.assumed) != 0 || creds.AccessKeyID != "AKIABASE" {
+					t.Errorf("assumed %d roles, access key %s, want the base credentials", len(client.assumed), creds.AccessKeyID)
+				}
+				return
+			}
+			if len(client.assumed) != 1 {
+				t.Fatalf("assumed %d roles, want 1", len(client.assumed))
+			}
+			input := client.assumed[0]
+			if got := aws.ToString(input.RoleArn); got != tt.wantRoleARN {
+				t.Errorf("RoleArn = %q, want %q", got, tt.wantRoleARN)
+			}
+			if got := aws.ToString(input.RoleSessionName); got != tt.wantSessionName {
+				t.Errorf("RoleSessionName = %q, want %q", got, tt.wantSessionName)
+			}
+			if got := aws.ToString(input.ExternalId); got != tt.wantExternalID {
+				t.Errorf("ExternalId = %q, want %q", got, tt.wantExternalID)
+			}
+			if creds.AccessKeyID != "ASIA"+tt.wantSessionName {
+				t.Errorf("AccessKeyID = %q, want the assumed role's credentials", creds.AccessKeyID)
+			}
+		})
+	}
+}
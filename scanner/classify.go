@@ -0,0 +1,177 @@
+package scanner
+
+import (
+	"fmt"
+	"time"
+)
+
+// Status is the whoAMI status of an AMI: how much the AMI can be trusted based on who owns it.
+type Status int
+
+const (
+	// StatusUnknown is the status of an AMI that none of the rules matched
+	StatusUnknown Status = iota
+	StatusVerified
+	StatusSelfHosted
+	StatusAllowed
+	StatusTrusted
+	StatusPrivateShared
+	StatusUnverifiedButKnown
+	StatusUnverified
+)
+
+var statusNames = map[Status]string{
+	StatusUnknown:            "Unknown",
+	StatusVerified:           "Verified",
+	StatusSelfHosted:         "Self hosted",
+	StatusAllowed:            "Allowed",
+	StatusTrusted:            "Trusted",
+	StatusPrivateShared:      "Private Shared",
+	StatusUnverifiedButKnown: "Unverified but known",
+	StatusUnverified:         "Unverified",
+}
+
+var statusCodes = map[Status]string{
+	StatusUnknown:            "unknown",
+	StatusVerified:           "verified",
+	StatusSelfHosted:         "self-hosted",
+	StatusAllowed:            "allowed",
+	StatusTrusted:            "trusted",
+	StatusPrivateShared:      "private-shared",
+	StatusUnverifiedButKnown: "unverified-but-known",
+	StatusUnverified:         "unverified",
+}
+
+// Statuses lists every status an AMI can be reported with, from most to least trusted.
+var Statuses = []Status{
+	StatusSelfHosted,
+	StatusAllowed,
+	StatusTrusted,
+	StatusVerified,
+	StatusPrivateShared,
+	StatusUnknown,
+	StatusUnverifiedButKnown,
+	StatusUnverified,
+}
+
+// Code returns the stable, machine-readable identifier of the status, such as "private-shared".
+func (s Status) Code() string {
+	return statusCodes[s]
+}
+
+// ParseStatus returns the status identified by code, as returned by Status.Code.
+func ParseStatus(code string) (Status, error) {
+	for status, c := range statusCodes {
+		if c == code {
+			return status, nil
+		}
+	}
+	return StatusUnknown, fmt.Errorf("unknown whoAMI status %q", code)
+}
+
+// MarshalText encodes the status as its code.
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.Code()), nil
+}
+
+// UnmarshalText decodes a status from its code.
+func (s *Status) UnmarshalText(text []byte) error {
+	status, err := ParseStatus(string(text))
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// ClassificationContext is the account and region state an AMI is classified against.
+type ClassificationContext struct {
+	// Account is the ID of the account the AMI is used in
+	Account string
+	// AllowedAMIsState is the "Allowed AMIs" state of the AMI's region: "enabled", "audit-mode" or "disabled"
+	AllowedAMIsState string
+	// AllowedAMIAccounts are the image providers allowed by the "Allowed AMIs" setting of the AMI's region
+	AllowedAMIAccounts []string
+	// TrustedAccounts are account IDs the user trusts to share AMIs
+	TrustedAccounts []string
+	// TrustPolicy holds the trust rules read from the user's trust policy file. It may be nil.
+	TrustPolicy *TrustPolicy
+	// Now is the time trust rule expiry dates are compared to. When zero, the current time is used.
+	Now time.Time
+	// Organization holds the accounts of the user's AWS Organization whose AMIs are trusted. It may be nil.
+	Organization *OrganizationTrust
+}
+
+// Classify returns the whoAMI status of an AMI along with the reason the status was picked. It makes no API calls;
+// the AMI's owner details, including OwnerName, must already be filled in.
+func Classify(ami AMI, ctx ClassificationContext) (Status, string) {
+	now := ctx.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if ami.OwnerAlias != "" {
+		switch ami.OwnerAlias {
+		case "amazon":
+			return StatusVerified, "community AMI from an AWS verified account (owner alias \"amazon\")"
+		case "aws-marketplace":
+			return StatusVerified, "AWS marketplace AMI from a verified account (owner alias \"aws-marketplace\")"
+		case "self":
+			return StatusSelfHosted, "hosted from this account (owner alias \"self\")"
+		}
+		if reason, ok := ctx.TrustPolicy.Trusts(ami, ctx.Account, now); ok {
+			return StatusTrusted, reason
+		}
+		return StatusUnknown, fmt.Sprintf("unrecognized owner alias %q", ami.OwnerAlias)
+	}
+
+	// The AMI has no OwnerAlias specified which means it is a community AMI or shared directly with this account.
+
+	// check if the AMI is from an allowed account
+	if ctx.AllowedAMIsState == "enabled" || ctx.AllowedAMIsState == "audit-mode" {
+		if contains(ctx.AllowedAMIAccounts, ami.OwnerID) {
+			return StatusAllowed, fmt.Sprintf("owner %s is an allowed image provider (Allowed AMIs %s)", ami.OwnerID,
+				ctx.AllowedAMIsState)
+		}
+	}
+
+	// check to see if the AMI is from a trusted account that the user has specified
+	if contains(ctx.TrustedAccounts, ami.OwnerID) {
+		return StatusTrusted, fmt.Sprintf("owner %s is a user provided trusted account", ami.OwnerID)
+	}
+	if reason, ok := ctx.TrustPolicy.Trusts(ami, ctx.Account, now); ok {
+		return StatusTrusted, reason
+	}
+
+	// check to see if the AMI is from another account of the user's organization. AMIs of the account itself are
+	// still self hosted.
+	if ami.OwnerID != ctx.Account {
+		if reason, ok := ctx.Organization.Trusts(ami.OwnerID); ok {
+			return StatusTrusted, reason
+		}
+	}
+
+	// check to see if the AMI is shared privately with this account (but not trusted or allowed)
+	if ami.Public == "Private" {
+		// if the ownerID is the same as the caller identity, then it is self hosted
+		if ami.OwnerID == ctx.Account {
+			return StatusSelfHosted, fmt.Sprintf("private AMI owned by this account (%s)", ami.OwnerID)
+		}
+		return StatusPrivateShared, fmt.Sprintf("privately shared by %s, which is not a trusted or allowed account",
+			ami.OwnerID)
+	}
+
+	// if the ami.OwnerName is not empty or "unknown" then it is a community AMI
+	if ami.OwnerName != "" && ami.OwnerName != AmiOwnerNameUnknown {
+		return StatusUnverifiedButKnown, fmt.Sprintf("owner %s is unverified but is known to the community as %s",
+			ami.OwnerID, ami.OwnerName)
+	}
+	return StatusUnverified, fmt.Sprintf("owner %s is unverified and not a known vendor", ami.OwnerID)
+}
@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name       string
+		ami        AMI
+		ctx        ClassificationContext
+		want       Status
+		wantReason string
+	}{
+		{
+			name:       "unrecognized owner alias is not classified",
+			ami:        AMI{OwnerAlias: "aws-backup-vault", OwnerID: unknownOwner, Public: "Public"},
+			want:       StatusUnknown,
+			wantReason: "aws-backup-vault",
+		},
+		{
+			name: "allowed takes precedence over trusted",
+			ami:  AMI{OwnerID: unknownOwner, Public: "Private"},
+			ctx: ClassificationContext{
+				Account:            testAccount,
+				AllowedAMIsState:   "enabled",
+				AllowedAMIAccounts: []string{unknownOwner},
+				TrustedAccounts:    []string{unknownOwner},
+			},
+			want:       StatusAllowed,
+			wantReason: "Allowed AMIs enabled",
+		},
+		{
+			name: "trusted takes precedence over self hosted",
+			ami:  AMI{OwnerID: testAccount, Public: "Private"},
+			ctx: ClassificationContext{
+				Account:         testAccount,
+				TrustedAccounts: []string{testAccount},
+			},
+			want:       StatusTrusted,
+			wantReason: "trusted account",
+		},
+		{
+			name: "trust policy trusts an owner alias",
+			ami:  AMI{OwnerAlias: "aws-backup-vault", OwnerID: unknownOwner, Public: "Private"},
+			ctx: ClassificationContext{
+				Account:     testAccount,
+				TrustPolicy: &TrustPolicy{Rules: []TrustRule{{OwnerAlias: "aws-backup-vault", Source: "trust.yaml:2"}}},
+			},
+			want:       StatusTrusted,
+			wantReason: "trust.yaml:2",
+		},
+		{
+			name: "expired trust policy rule no longer applies",
+			ami:  AMI{OwnerID: unknownOwner, Public: "Private"},
+			ctx: ClassificationContext{
+				Account: testAccount,
+				TrustPolicy: &TrustPolicy{Rules: []TrustRule{
+					{Account: unknownOwner, Expires: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Source: "trust.yaml:2"},
+				}},
+				Now: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC),
+			},
+			want:       StatusPrivateShared,
+			wantReason: "privately shared",
+		},
+		{
+			name:       "public AMI owned by the caller is not self hosted",
+			ami:        AMI{OwnerID: testAccount, OwnerName: AmiOwnerNameUnknown, Public: "Public"},
+			ctx:        ClassificationContext{Account: testAccount},
+			want:       StatusUnverified,
+			wantReason: testAccount,
+		},
+		{
+			name: "organization member is trusted",
+			ami:  AMI{OwnerID: unknownOwner, Public: "Private"},
+			ctx: ClassificationContext{
+				Account:      testAccount,
+				Organization: &OrganizationTrust{ID: "o-a1b2c3d4e5", Accounts: map[string]string{unknownOwner: ""}},
+			},
+			want:       StatusTrusted,
+			wantReason: "member of the trusted organization o-a1b2c3d4e5",
+		},
+		{
+			name: "organization trust does not replace self hosted",
+			ami:  AMI{OwnerID: testAccount, Public: "Private"},
+			ctx: ClassificationContext{
+				Account:      testAccount,
+				Organization: &OrganizationTrust{ID: "o-a1b2c3d4e5", Accounts: map[string]string{testAccount: ""}},
+			},
+			want:       StatusSelfHosted,
+			wantReason: "owned by this account",
+		},
+		{
+			name: "trust policy rule with image names leaves other AMIs of the owner untrusted",
+			ami:  AMI{OwnerID: canonicalOwner, OwnerName: "Canonical", Name: "ubuntu-minimal/images/jammy", Public: "Public"},
+			ctx: ClassificationContext{
+				Account: testAccount,
+				TrustPolicy: &TrustPolicy{Rules: []TrustRule{
+					{Account: canonicalOwner, ImageNames: []string{"ubuntu/images/*"}, Source: "trust.yaml:2"},
+				}},
+			},
+			want:       StatusUnverifiedButKnown,
+			wantReason: "Canonical",
+		},
+		{
+			name:       "known vendor name is part of the reason",
+			ami:        AMI{OwnerID: canonicalOwner, OwnerName: "Canonical", Public: "Public"},
+			want:       StatusUnverifiedButKnown,
+			wantReason: "Canonical",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := Classify(tt.ami, tt.ctx)
+			if got != tt.want {
+				t.Errorf("Classify() status = %v, want %v", got, tt.want)
+			}
+			if !strings.Contains(reason, tt.wantReason) {
+				t.Errorf("Classify() reason = %q, want it to contain %q", reason, tt.wantReason)
+			}
+		})
+	}
+}
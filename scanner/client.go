@@ -0,0 +1,47 @@
+package scanner
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// EC2API is the subset of the EC2 API the scanner uses. It is satisfied by *ec2.Client.
+type EC2API interface {
+	DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error)
+	DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error)
+	DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error)
+	DescribeInstanceImageMetadata(ctx context.Context, params *ec2.DescribeInstanceImageMetadataInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceImageMetadataOutput, error)
+	GetAllowedImagesSettings(ctx context.Context, params *ec2.GetAllowedImagesSettingsInput, optFns ...func(*ec2.Options)) (*ec2.GetAllowedImagesSettingsOutput, error)
+}
+
+// STSAPI is the subset of the STS API the scanner uses. It is satisfied by *sts.Client.
+type STSAPI interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+var (
+	_ EC2API = (*ec2.Client)(nil)
+	_ STSAPI = (*sts.Client)(nil)
+)
+
+// ec2Client returns the EC2 client for a region, built from Options.NewEC2Client if set or the scanner's AWS
+// config otherwise.
+func (s *Scanner) ec2Client(region string) EC2API {
+	if s.opts.NewEC2Client != nil {
+		return s.opts.NewEC2Client(region)
+	}
+	return ec2.NewFromConfig(s.cfg, func(o *ec2.Options) {
+		if region != "" {
+			o.Region = region
+		}
+	})
+}
+
+func (s *Scanner) stsClient() STSAPI {
+	if s.opts.STSClient != nil {
+		return s.opts.STSClient
+	}
+	return sts.NewFromConfig(s.cfg)
+}
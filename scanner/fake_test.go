@@ -0,0 +1,253 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// fakeEC2 is an in-memory EC2API holding the state of a single region.
+type fakeEC2 struct {
+	mu sync.Mutex
+
+	instances []types.Instance
+	// instancesPageSize is the number of instances returned per ec2:DescribeInstances page. 0 means no paging.
+	instancesPageSize int
+	// images are the AMIs visible to ec2:DescribeImages
+	images map[string]types.Image
+	// imageMetadata is returned by ec2:DescribeInstanceImageMetadata, keyed by instance ID
+	imageMetadata map[string]types.ImageMetadata
+
+	// describeInstancesErr, describeImagesErr and imageMetadataErr are returned by the matching API when set
+	describeInstancesErr error
+	describeImagesErr    error
+	imageMetadataErr     error
+
+	allowedState     string
+	allowedProviders []string
+	allowedErr       error
+
+	regions []string
+
+	// calls counts the calls made to each API
+	calls map[string]int
+	// imageBatches holds the number of AMI IDs asked for by each ec2:DescribeImages call
+	imageBatches []int
+}
+
+func newFakeEC2() *fakeEC2 {
+	return &fakeEC2{
+		images:        make(map[string]types.Image),
+		imageMetadata: make(map[string]types.ImageMetadata),
+		allowedState:  "disabled",
+		calls:         make(map[string]int),
+	}
+}
+
+// addInstance adds a running instance launched from amiID.
+func (f *fakeEC2) addInstance(instanceID, amiID, name string) {
+	instance := types.Instance{
+		InstanceId: aws.String(instanceID),
+		ImageId:    aws.String(amiID),
+	}
+	if name != "" {
+		instance.Tags = []types.Tag{{Key: aws.String("Name"), Value: aws.String(name)}}
+	}
+	f.instances = append(f.instances, instance)
+}
+
+func (f *fakeEC2) addImage(image types.Image) {
+	f.images[aws.ToString(image.ImageId)] = image
+}
+
+func (f *fakeEC2) record(api string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[api]++
+}
+
+func (f *fakeEC2) DescribeRegions(ctx context.Context, params *ec2.DescribeRegionsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeRegionsOutput, error) {
+	f.record("DescribeRegions")
+	out := &ec2.DescribeRegionsOutput{}
+	for _, region := range f.regions {
+		out.Regions = append(out.Regions, types.Region{RegionName: aws.String(region)})
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	f.record("DescribeInstances")
+	if f.describeInstancesErr != nil {
+		return nil, f.describeInstancesErr
+	}
+	var instances []types.Instance
+	for _, instance := range f.instances {
+		if len(params.InstanceIds) == 0 || contains(params.InstanceIds, aws.ToString(instance.InstanceId)) {
+			instances = append(instances, instance)
+		}
+	}
+
+	// Each instance gets its own reservation and pages hold instancesPageSize reservations
+	start := 0
+	if params.NextToken != nil {
+		start, _ = strconv.Atoi(*params.NextToken)
+	}
+	end := len(instances)
+	if f.instancesPageSize > 0 && start+f.instancesPageSize < end {
+		end = start + f.instancesPageSize
+	}
+	out := &ec2.DescribeInstancesOutput{}
+	for _, instance := range instances[start:end] {
+		out.Reservations = append(out.Reservations, types.Reservation{Instances: []types.Instance{instance}})
+	}
+	if end < len(instances) {
+		out.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	f.record("DescribeImages")
+	ids := params.ImageIds
+	for _, filter := range params.Filters {
+		if aws.ToString(filter.Name) == "image-id" {
+			ids = append(ids, filter.Values...)
+		}
+	}
+	f.mu.Lock()
+	f.imageBatches = append(f.imageBatches, len(ids))
+	f.mu.Unlock()
+	if f.describeImagesErr != nil {
+		return nil, f.describeImagesErr
+	}
+	out := &ec2.DescribeImagesOutput{}
+	for _, id := range ids {
+		if image, ok := f.images[id]; ok {
+			out.Images = append(out.Images, image)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) DescribeInstanceImageMetadata(ctx context.Context, params *ec2.DescribeInstanceImageMetadataInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceImageMetadataOutput, error) {
+	f.record("DescribeInstanceImageMetadata")
+	if f.imageMetadataErr != nil {
+		return nil, f.imageMetadataErr
+	}
+	out := &ec2.DescribeInstanceImageMetadataOutput{}
+	for _, id := range params.InstanceIds {
+		metadata, ok := f.imageMetadata[id]
+		if !ok {
+			continue
+		}
+		out.InstanceImageMetadata = append(out.InstanceImageMetadata, types.InstanceImageMetadata{
+			InstanceId:    aws.String(id),
+			ImageMetadata: &metadata,
+		})
+	}
+	return out, nil
+}
+
+func (f *fakeEC2) GetAllowedImagesSettings(ctx context.Context, params *ec2.GetAllowedImagesSettingsInput, optFns ...func(*ec2.Options)) (*ec2.GetAllowedImagesSettingsOutput, error) {
+	f.record("GetAllowedImagesSettings")
+	if f.allowedErr != nil {
+		return nil, f.allowedErr
+	}
+	out := &ec2.GetAllowedImagesSettingsOutput{State: aws.String(f.allowedState)}
+	if len(f.allowedProviders) > 0 {
+		out.ImageCriteria = []types.ImageCriterion{{ImageProviders: f.allowedProviders}}
+	}
+	return out, nil
+}
+
+// fakeSTS returns a fixed caller identity, and records the roles assumed through it.
+type fakeSTS struct {
+	account string
+	assumed []*sts.AssumeRoleInput
+}
+
+func (f *fakeSTS) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(f.account),
+		Arn:     aws.String(fmt.Sprintf("arn:aws:iam::%s:user/scanner", f.account)),
+	}, nil
+}
+
+func (f *fakeSTS) AssumeRole(ctx context.Context, params *sts.AssumeRoleInput, optFns ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+	f.assumed = append(f.assumed, params)
+	return &sts.AssumeRoleOutput{Credentials: &ststypes.Credentials{
+		AccessKeyId:     aws.String("ASIA" + aws.ToString(params.RoleSessionName)),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	}}, nil
+}
+
+// fakeOrganizations returns the accounts of an organization, one per organizations:ListAccounts page.
+type fakeOrganizations struct {
+	id       string
+	accounts []orgtypes.Account
+	// accountsByParent and ousByParent hold the accounts and child OUs of each root or OU
+	accountsByParent map[string][]orgtypes.Account
+	ousByParent      map[string][]string
+}
+
+func (f *fakeOrganizations) DescribeOrganization(ctx context.Context, params *organizations.DescribeOrganizationInput, optFns ...func(*organizations.Options)) (*organizations.DescribeOrganizationOutput, error) {
+	return &organizations.DescribeOrganizationOutput{Organization: &orgtypes.Organization{Id: aws.String(f.id)}}, nil
+}
+
+func (f *fakeOrganizations) ListAccountsForParent(ctx context.Context, params *organizations.ListAccountsForParentInput, optFns ...func(*organizations.Options)) (*organizations.ListAccountsForParentOutput, error) {
+	return &organizations.ListAccountsForParentOutput{Accounts: f.accountsByParent[aws.ToString(params.ParentId)]}, nil
+}
+
+func (f *fakeOrganizations) ListOrganizationalUnitsForParent(ctx context.Context, params *organizations.ListOrganizationalUnitsForParentInput, optFns ...func(*organizations.Options)) (*organizations.ListOrganizationalUnitsForParentOutput, error) {
+	out := &organizations.ListOrganizationalUnitsForParentOutput{}
+	for _, ou := range f.ousByParent[aws.ToString(params.ParentId)] {
+		out.OrganizationalUnits = append(out.OrganizationalUnits, orgtypes.OrganizationalUnit{Id: aws.String(ou)})
+	}
+	return out, nil
+}
+
+func (f *fakeOrganizations) ListAccounts(ctx context.Context, params *organizations.ListAccountsInput, optFns ...func(*organizations.Options)) (*organizations.ListAccountsOutput, error) {
+	start := 0
+	if params.NextToken != nil {
+		start, _ = strconv.Atoi(*params.NextToken)
+	}
+	out := &organizations.ListAccountsOutput{}
+	if start < len(f.accounts) {
+		out.Accounts = f.accounts[start : start+1]
+	}
+	if start+1 < len(f.accounts) {
+		out.NextToken = aws.String(strconv.Itoa(start + 1))
+	}
+	return out, nil
+}
+
+// newFakeScanner returns a Scanner backed by one fake per region.
+func newFakeScanner(account string, fakes map[string]*fakeEC2, opts Options) *Scanner {
+	opts.NewEC2Client = func(region string) EC2API {
+		if fake, ok := fakes[region]; ok {
+			return fake
+		}
+		// Region discovery uses the default region's client
+		fake := newFakeEC2()
+		for region := range fakes {
+			fake.regions = append(fake.regions, region)
+		}
+		sort.Strings(fake.regions)
+		return fake
+	}
+	opts.STSClient = &fakeSTS{account: account}
+	return New(aws.Config{}, opts)
+}
@@ -0,0 +1,200 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go/ptr"
+)
+
+// describeBatchSize is the number of AMI or instance IDs looked up per call. EC2 accepts at most 200 values per
+// filter.
+const describeBatchSize = 200
+
+// describeAMIs looks up the details of the AMIs in a region, keyed by AMI ID. AMIs that are no longer visible to
+// ec2:DescribeImages (they were deleted, made private, or are blocked by Allowed AMIs) are looked up from the
+// metadata of an instance launched from them instead; instanceByAMI maps each AMI ID to such an instance. AMIs that
+// could not be looked up either way are missing from the returned map and reported in the returned errors. AMIs of a
+// failed ec2:DescribeImages call are reported too, as the instance metadata lacks some of their details.
+func (s *Scanner) describeAMIs(ctx context.Context, out io.Writer, ec2Client EC2API, region string, amiIDs []string,
+	instanceByAMI map[string]string) (map[string]AMI, []ScanError) {
+	var mu sync.Mutex
+	amis := make(map[string]AMI, len(amiIDs))
+
+	amiBatches := batches(amiIDs, describeBatchSize)
+	imageErrs := make([]error, len(amiBatches))
+	forEach(len(amiBatches), s.concurrency(), func(i int) {
+		batch := amiBatches[i]
+		if s.opts.Verbose {
+			cyan.Fprintf(out, "[*] [%s] Looking up %d AMIs\n", region, len(batch))
+		}
+		// Filtering on image-id rather than passing ImageIds means one missing AMI doesn't fail the whole batch
+		// with InvalidAMIID.NotFound
+		paginator := ec2.NewDescribeImagesPaginator(ec2Client, &ec2.DescribeImagesInput{
+			Filters:           []types.Filter{{Name: aws.String("image-id"), Values: batch}},
+			IncludeDeprecated: aws.Bool(true),
+			IncludeDisabled:   aws.Bool(true),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				s.logger.Warn("Error fetching AMI details", "region", region, "amis", len(batch),
+					"request_id", RequestID(err), "error", err)
+				imageErrs[i] = err
+				break
+			}
+			mu.Lock()
+			for _, image := range page.Images {
+				ami := s.amiFromImage(region, image)
+				amis[ami.ID] = ami
+			}
+			mu.Unlock()
+		}
+	})
+
+	var errs []ScanError
+	for i, batch := range amiBatches {
+		if imageErrs[i] == nil {
+			continue
+		}
+		var missing []string
+		for _, amiID := range batch {
+			if _, ok := amis[amiID]; !ok {
+				missing = append(missing, amiID)
+			}
+		}
+		if len(missing) > 0 {
+			errs = append(errs, ScanError{Region: region, Operation: "DescribeImages", Resources: missing, Err: imageErrs[i]})
+		}
+	}
+
+	// try to get the info via the instance metadata instead
+	var missingInstances []string
+	amiByInstance := make(map[string]string)
+	for _, amiID := range amiIDs {
+		if _, ok := amis[amiID]; !ok {
+			missingInstances = append(missingInstances, instanceByAMI[amiID])
+			amiByInstance[instanceByAMI[amiID]] = amiID
+		}
+	}
+	instanceBatches := batches(missingInstances, describeBatchSize)
+	batchErrs := make([]error, len(instanceBatches))
+	forEach(len(instanceBatches), s.concurrency(), func(i int) {
+		batch := instanceBatches[i]
+		paginator := ec2.NewDescribeInstanceImageMetadataPaginator(ec2Client, &ec2.DescribeInstanceImageMetadataInput{
+			InstanceIds: batch,
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				s.logger.Warn("AMIs were found that are not public, and ec2:DescribeInstanceImageMetadata failed",
+					"region", region, "amis", len(batch), "request_id", RequestID(err), "error", err)
+				batchErrs[i] = err
+				break
+			}
+			mu.Lock()
+			for _, metadata := range page.InstanceImageMetadata {
+				if metadata.ImageMetadata == nil {
+					continue
+				}
+				ami := s.amiFromImageMetadata(region, *metadata.ImageMetadata)
+				amis[ami.ID] = ami
+			}
+			mu.Unlock()
+		}
+	})
+
+	var notFound []string
+	for i, batch := range instanceBatches {
+		var unclassified []string
+		for _, instanceID := range batch {
+			if amiID := amiByInstance[instanceID]; amis[amiID].ID == "" {
+				unclassified = append(unclassified, amiID)
+			}
+		}
+		if len(unclassified) == 0 {
+			continue
+		}
+		if batchErrs[i] != nil {
+			errs = append(errs, ScanError{
+				Region:    region,
+				Operation: "DescribeInstanceImageMetadata",
+				Resources: unclassified,
+				Err:       batchErrs[i],
+			})
+		} else {
+			notFound = append(notFound, unclassified...)
+		}
+	}
+	if len(notFound) > 0 {
+		errs = append(errs, ScanError{
+			Region:    region,
+			Operation: "DescribeInstanceImageMetadata",
+			Resources: notFound,
+			Err:       ErrAMINotFound,
+		})
+	}
+	return amis, errs
+}
+
+func (s *Scanner) amiFromImage(region string, image types.Image) AMI {
+	publicString := "Private"
+	if aws.ToBool(image.Public) {
+		publicString = "Public"
+	}
+	return AMI{
+		ID:          ptr.ToString(image.ImageId),
+		Region:      region,
+		OwnerAlias:  ptr.ToString(image.ImageOwnerAlias),
+		OwnerID:     ptr.ToString(image.OwnerId),
+		OwnerName:   s.vendorName(ptr.ToString(image.OwnerId)),
+		Name:        ptr.ToString(image.Name),
+		Description: ptr.ToString(image.Description),
+		Public:      publicString,
+	}
+}
+
+func (s *Scanner) amiFromImageMetadata(region string, metadata types.ImageMetadata) AMI {
+	publicString := "Private"
+	if aws.ToBool(metadata.IsPublic) {
+		publicString = "Public"
+	}
+
+	var imageOwnerAlias string
+	// if metadata.ImageOwnerAlias is the account ID then change it to ""
+	// This is required because if allowed AMIs is enabled, the initial describeImages call no
+	// longer returns AMIs that are are not allowed and we/need to use the metadata API call
+	// instead. This metadata uniquely returns the account ID as the ownerAlias which was
+	// messing with the logic
+	if ptr.ToString(metadata.ImageOwnerAlias) != ptr.ToString(metadata.OwnerId) {
+		imageOwnerAlias = ptr.ToString(metadata.ImageOwnerAlias)
+	}
+
+	return AMI{
+		ID:          ptr.ToString(metadata.ImageId),
+		Region:      region,
+		OwnerAlias:  imageOwnerAlias,
+		OwnerID:     ptr.ToString(metadata.OwnerId),
+		OwnerName:   s.vendorName(ptr.ToString(metadata.OwnerId)),
+		Name:        ptr.ToString(metadata.Name),
+		Description: "Unable to find description. AMI has been deleted or made private",
+		Public:      publicString,
+	}
+}
+
+// batches splits ids into consecutive batches of at most size IDs.
+func batches(ids []string, size int) [][]string {
+	var out [][]string
+	for len(ids) > size {
+		out = append(out, ids[:size])
+		ids = ids[size:]
+	}
+	if len(ids) > 0 {
+		out = append(out, ids)
+	}
+	return out
+}
@@ -0,0 +1,220 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	"github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+// OrganizationsAPI is the subset of the AWS Organizations API used to list the accounts of an organization and of its
+// organizational units.
+type OrganizationsAPI interface {
+	DescribeOrganization(ctx context.Context, params *organizations.DescribeOrganizationInput, optFns ...func(*organizations.Options)) (*organizations.DescribeOrganizationOutput, error)
+	ListAccounts(ctx context.Context, params *organizations.ListAccountsInput, optFns ...func(*organizations.Options)) (*organizations.ListAccountsOutput, error)
+	ListAccountsForParent(ctx context.Context, params *organizations.ListAccountsForParentInput, optFns ...func(*organizations.Options)) (*organizations.ListAccountsForParentOutput, error)
+	ListOrganizationalUnitsForParent(ctx context.Context, params *organizations.ListOrganizationalUnitsForParentInput, optFns ...func(*organizations.Options)) (*organizations.ListOrganizationalUnitsForParentOutput, error)
+}
+
+// ListAccounts returns the IDs of the active accounts of the organization, following organizations:ListAccounts
+// pagination. Suspended accounts cannot be scanned and are left out.
+func ListAccounts(ctx context.Context, client OrganizationsAPI) ([]string, error) {
+	var accounts []string
+	paginator := organizations.NewListAccountsPaginator(client, &organizations.ListAccountsInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list organization accounts: %w", err)
+		}
+		for _, account := range page.Accounts {
+			if account.Status == types.AccountStatusActive {
+				accounts = append(accounts, aws.ToString(account.Id))
+			}
+		}
+	}
+	return accounts, nil
+}
+
+// OrganizationTrust holds the accounts of an AWS Organization whose AMIs are trusted.
+type OrganizationTrust struct {
+	// ID is the ID of the organization, such as "o-a1b2c3d4e5"
+	ID string
+	// Accounts maps each trusted account to the organizational unit it was found under, or to "" when the whole
+	// organization is trusted
+	Accounts map[string]string
+}
+
+// LoadOrganizationTrust lists the active accounts of the caller's organization. When ous is not empty, only the
+// accounts under those organizational units, including their child OUs, are trusted.
+func LoadOrganizationTrust(ctx context.Context, client OrganizationsAPI, ous []string) (*OrganizationTrust, error) {
+	org, err := client.DescribeOrganization(ctx, &organizations.DescribeOrganizationInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe the organization: %w", err)
+	}
+	trust := &OrganizationTrust{ID: aws.ToString(org.Organization.Id), Accounts: make(map[string]string)}
+	if len(ous) == 0 {
+		accounts, err := ListAccounts(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+		for _, account := range accounts {
+			trust.Accounts[account] = ""
+		}
+		return trust, nil
+	}
+	for _, ou := range ous {
+		if err := trust.addOU(ctx, client, ou, ou); err != nil {
+			return nil, err
+		}
+	}
+	return trust, nil
+}
+
+// addOU adds the active accounts under parent, an OU within the trusted OU ou, and recurses into its child OUs.
+func (t *OrganizationTrust) addOU(ctx context.Context, client OrganizationsAPI, ou, parent string) error {
+	accounts := organizations.NewListAccountsForParentPaginator(client, &organizations.ListAccountsForParentInput{
+		ParentId: aws.String(parent),
+	})
+	for accounts.HasMorePages() {
+		page, err := accounts.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list the accounts of %s: %w", parent, err)
+		}
+		for _, account := range page.Accounts {
+			if account.Status == types.AccountStatusActive {
+				t.Accounts[aws.ToString(account.Id)] = ou
+			}
+		}
+	}
+	children := organizations.NewListOrganizationalUnitsForParentPaginator(client,
+		&organizations.ListOrganizationalUnitsForParentInput{ParentId: aws.String(parent)})
+	for children.HasMorePages() {
+		page, err := children.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list the organizational units of %s: %w", parent, err)
+		}
+		for _, child := range page.OrganizationalUnits {
+			if err := t.addOU(ctx, client, ou, aws.ToString(child.Id)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Trusts reports whether AMIs owned by account are trusted, along with the reason.
+func (t *OrganizationTrust) Trusts(account string) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+	ou, ok := t.Accounts[account]
+	switch {
+	case !ok:
+		return "", false
+	case ou != "":
+		return fmt.Sprintf("owner %s is in the trusted organizational unit %s of organization %s", account, ou, t.ID), true
+	default:
+		return fmt.Sprintf("owner %s is a member of the trusted organization %s", account, t.ID), true
+	}
+}
+
+// AccountScanOptions controls how ScanAccounts scans several accounts.
+type AccountScanOptions struct {
+	// Concurrency is the maximum number of accounts scanned at once. Values below 1 scan one account at a time.
+	Concurrency int
+	// Progress receives human-readable progress messages. When nil, progress is discarded.
+	Progress io.Writer
+	// Logger receives warnings about accounts that could not be scanned. When nil, they are discarded.
+	Logger *slog.Logger
+	// NewScanner returns the Scanner of an account, typically using credentials from a role assumed in it. The
+	// Scanner should write its progress to progress, which keeps the output of accounts scanned at once apart.
+	NewScanner func(ctx context.Context, account string, progress io.Writer) (*Scanner, error)
+}
+
+// ScanAccounts scans every account and consolidates the results into one Result, whose Identity is identity. An
+// account that cannot be scanned, for instance because its role cannot be assumed, is recorded in
+// Result.AccountErrors and the other accounts are still scanned. Results and progress are merged in account order.
+func ScanAccounts(ctx context.Context, identity Identity, accounts []string, opts AccountScanOptions) *Result {
+	out := opts.Progress
+	if out == nil {
+		out = io.Discard
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	result := newResult()
+	result.Identity = identity
+	result.ScannedAt = time.Now().UTC()
+
+	results := make([]*Result, len(accounts))
+	errs := make([]error, len(accounts))
+	progress := make([]*syncBuffer, len(accounts))
+	done := make([]chan struct{}, len(accounts))
+	for i := range accounts {
+		progress[i] = &syncBuffer{}
+		done[i] = make(chan struct{})
+	}
+	go forEach(len(accounts), opts.Concurrency, func(i int) {
+		results[i], errs[i] = scanAccount(ctx, accounts[i], progress[i], opts.NewScanner)
+		close(done[i])
+	})
+	for i, account := range accounts {
+		<-done[i]
+		progress[i].WriteTo(out)
+		if err := errs[i]; err != nil {
+			logger.Warn("Error scanning account", "account", account, "request_id", RequestID(err), "error", err)
+			result.AccountErrors = append(result.AccountErrors, AccountError{Account: account, Err: err})
+			continue
+		}
+		result.merge(results[i])
+	}
+	return result
+}
+
+func scanAccount(ctx context.Context, account string, progress io.Writer,
+	newScanner func(context.Context, string, io.Writer) (*Scanner, error)) (*Result, error) {
+	fmt.Fprintf(progress, "[*] Scanning account %s\n", cyan.Sprint(account))
+	s, err := newScanner(ctx, account, progress)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// A role that resolves to another account would attribute its instances to the wrong account
+	if result.Identity.Account != account {
+		return nil, fmt.Errorf("credentials are for account %s", result.Identity.Account)
+	}
+	return result, nil
+}
+
+// merge adds the result of another account's scan to the result.
+func (r *Result) merge(other *Result) {
+	r.Accounts = append(r.Accounts, other.Accounts...)
+	r.Regions = append(r.Regions, other.Regions...)
+	maps.Copy(r.AllowedAMIStateByRegion, other.AllowedAMIStateByRegion)
+	maps.Copy(r.AllowedAMIAccountsByRegion, other.AllowedAMIAccountsByRegion)
+	r.AllowedAMIPermissionDenied = r.AllowedAMIPermissionDenied || other.AllowedAMIPermissionDenied
+	r.Errors = append(r.Errors, other.Errors...)
+	r.AccountErrors = append(r.AccountErrors, other.AccountErrors...)
+
+	r.TotalInstances += other.TotalInstances
+	maps.Copy(r.ProcessedAMIs, other.ProcessedAMIs)
+	maps.Copy(r.AMIToInstances, other.AMIToInstances)
+	maps.Copy(r.VerifiedAMIs, other.VerifiedAMIs)
+	maps.Copy(r.SelfHostedAMIs, other.SelfHostedAMIs)
+	maps.Copy(r.AllowedAMIs, other.AllowedAMIs)
+	maps.Copy(r.TrustedAMIs, other.TrustedAMIs)
+	maps.Copy(r.PrivateSharedAMIs, other.PrivateSharedAMIs)
+	maps.Copy(r.UnverifiedButKnownAMIs, other.UnverifiedButKnownAMIs)
+	maps.Copy(r.UnverifiedAMIs, other.UnverifiedAMIs)
+}
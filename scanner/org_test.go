@@ -0,0 +1,142 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+)
+
+func TestListAccounts(t *testing.T) {
+	client := &fakeOrganizations{accounts: []orgtypes.Account{
+		{Id: aws.String("111111111111"), Status: orgtypes.AccountStatusActive},
+		{Id: aws.String("222222222222"), Status: orgtypes.AccountStatusSuspended},
+		{Id: aws.String("333333333333"), Status: orgtypes.AccountStatusActive},
+	}}
+	accounts, err := ListAccounts(context.Background(), client)
+	if err != nil {
+		t.Fatalf("ListAccounts() error = %v", err)
+	}
+	if want := []string{"111111111111", "333333333333"}; !slices.Equal(accounts, want) {
+		t.Errorf("ListAccounts() = %v, want %v", accounts, want)
+	}
+}
+
+func TestScanAccounts(t *testing.T) {
+	const (
+		member    = "333333333333"
+		noRole    = "444444444444"
+		wrongRole = "555555555555"
+		goldenAMI = "ami-golden"
+		callerArn = "arn:aws:iam::111111111111:user/scanner"
+	)
+	// The scanning account shares its golden AMI with a member account
+	newFakes := func(instanceID string) map[string]*fakeEC2 {
+		fake := newFakeEC2()
+		fake.addInstance(instanceID, goldenAMI, "")
+		fake.addImage(image(goldenAMI, testAccount, "", false))
+		return map[string]*fakeEC2{testRegion: fake}
+	}
+	scanners := map[string]*Scanner{
+		testAccount: newFakeScanner(testAccount, newFakes("i-root"), Options{Vendors: testVendors()}),
+		member:      newFakeScanner(member, newFakes("i-member"), Options{Vendors: testVendors()}),
+		wrongRole:   newFakeScanner(member, newFakes("i-wrong"), Options{Vendors: testVendors()}),
+	}
+
+	var progress bytes.Buffer
+	result := ScanAccounts(context.Background(), Identity{Account: testAccount, Arn: callerArn},
+		[]string{testAccount, member, noRole, wrongRole}, AccountScanOptions{
+			Concurrency: 4,
+			Progress:    &progress,
+			NewScanner: func(ctx context.Context, account string, progress io.Writer) (*Scanner, error) {
+				s, ok := scanners[account]
+				if !ok {
+					return nil, errors.New("AccessDenied: not authorized to perform sts:AssumeRole")
+				}
+				return s, nil
+			},
+		})
+
+	if want := []string{testAccount, member}; !slices.Equal(result.Accounts, want) {
+		t.Errorf("Accounts = %v, want %v", result.Accounts, want)
+	}
+	if len(result.AccountErrors) != 2 || result.AccountErrors[0].Account != noRole ||
+		result.AccountErrors[1].Account != wrongRole {
+		t.Fatalf("AccountErrors = %v, want errors for %s and %s", result.AccountErrors, noRole, wrongRole)
+	}
+	if !strings.Contains(result.AccountErrors[1].Error(), "credentials are for account "+member) {
+		t.Errorf("AccountErrors[1] = %v, want the mismatched account", result.AccountErrors[1])
+	}
+	if !result.Incomplete() || !result.MultiAccount() {
+		t.Errorf("Incomplete(), MultiAccount() = %v, %v, want true, true", result.Incomplete(), result.MultiAccount())
+	}
+	if result.Identity.Account != testAccount || result.TotalInstances != 2 || len(result.Regions) != 2 {
+		t.Errorf("Identity = %+v, TotalInstances = %d, Regions = %v", result.Identity, result.TotalInstances, result.Regions)
+	}
+
+	// The golden AMI is self hosted where it is owned, and privately shared in the member account
+	root := AMIKey{Account: testAccount, Region: testRegion, ID: goldenAMI}
+	shared := AMIKey{Account: member, Region: testRegion, ID: goldenAMI}
+	if _, ok := result.SelfHostedAMIs[root]; !ok {
+		t.Errorf("SelfHostedAMIs = %v, want %v", result.SelfHostedAMIs, root)
+	}
+	if ami, ok := result.PrivateSharedAMIs[shared]; !ok || ami.Account != member {
+		t.Errorf("PrivateSharedAMIs = %v, want %v", result.PrivateSharedAMIs, shared)
+	}
+	if instances := result.AMIToInstances[shared]; len(instances) != 1 || instances[0].Account != member {
+		t.Errorf("AMIToInstances[%v] = %v, want i-member", shared, instances)
+	}
+	if got := result.RegionLabel(RegionKey{Account: member, Region: testRegion}); got != member+"/"+testRegion {
+		t.Errorf("RegionLabel() = %q", got)
+	}
+
+	// Progress is written in account order
+	if got := progress.String(); strings.Index(got, testAccount) > strings.Index(got, wrongRole) {
+		t.Errorf("progress is out of account order:\n%s", got)
+	}
+}
+
+func TestLoadOrganizationTrust(t *testing.T) {
+	active := func(id string) orgtypes.Account {
+		return orgtypes.Account{Id: aws.String(id), Status: orgtypes.AccountStatusActive}
+	}
+	client := &fakeOrganizations{
+		id:       "o-a1b2c3d4e5",
+		accounts: []orgtypes.Account{active("111111111111"), active("222222222222"), active("333333333333")},
+		accountsByParent: map[string][]orgtypes.Account{
+			"ou-factory":       {active("222222222222")},
+			"ou-factory-child": {active("333333333333"), {Id: aws.String("444444444444"), Status: orgtypes.AccountStatusSuspended}},
+		},
+		ousByParent: map[string][]string{"ou-factory": {"ou-factory-child"}},
+	}
+
+	trust, err := LoadOrganizationTrust(context.Background(), client, nil)
+	if err != nil {
+		t.Fatalf("LoadOrganizationTrust() error = %v", err)
+	}
+	if trust.ID != "o-a1b2c3d4e5" || len(trust.Accounts) != 3 {
+		t.Errorf("LoadOrganizationTrust() = %+v, want the 3 accounts of o-a1b2c3d4e5", trust)
+	}
+
+	trust, err = LoadOrganizationTrust(context.Background(), client, []string{"ou-factory"})
+	if err != nil {
+		t.Fatalf("LoadOrganizationTrust() error = %v", err)
+	}
+	want := map[string]string{"222222222222": "ou-factory", "333333333333": "ou-factory"}
+	if !maps.Equal(trust.Accounts, want) {
+		t.Errorf("Accounts = %v, want %v", trust.Accounts, want)
+	}
+	if reason, ok := trust.Trusts("333333333333"); !ok || !strings.Contains(reason, "organizational unit ou-factory") {
+		t.Errorf("Trusts() = %q, %v", reason, ok)
+	}
+	if _, ok := trust.Trusts("111111111111"); ok {
+		t.Error("Trusts() = true for an account outside the trusted OU")
+	}
+}
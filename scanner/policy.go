@@ -0,0 +1,329 @@
+package scanner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TrustPolicy is the set of rules deciding which AMI owners are trusted, read from a trust policy file.
+type TrustPolicy struct {
+	Rules []TrustRule
+}
+
+// TrustRule trusts the AMIs of one owner account or owner alias, optionally only those with some names or
+// descriptions, in some regions or scanned accounts and until an expiry date.
+type TrustRule struct {
+	// Account is the ID of the trusted owner account. Exactly one of Account and OwnerAlias is set.
+	Account string
+	// OwnerAlias is the trusted owner alias, such as "aws-backup-vault"
+	OwnerAlias string
+	// Label says what the owner is, such as "Golden image factory". It is part of the classification reason.
+	Label string
+	// ImageNames limits the rule to AMIs whose name matches one of these patterns, in which * matches any characters
+	// and ? one character, like the image names of Allowed AMIs. ImageNameRegex is an alternative to the patterns.
+	// When both are empty, the rule applies to any name.
+	ImageNames     []string
+	ImageNameRegex *regexp.Regexp
+	// Descriptions and DescriptionRegex limit the rule to AMIs whose description matches, like ImageNames and
+	// ImageNameRegex
+	Descriptions     []string
+	DescriptionRegex *regexp.Regexp
+	// Regions limits the rule to AMIs used in these regions. When empty, the rule applies in every region.
+	Regions []string
+	// Accounts limits the rule to AMIs used in these scanned accounts. When empty, the rule applies in every account.
+	Accounts []string
+	// Expires is when the rule stops applying, for temporary exceptions. When zero, the rule does not expire.
+	Expires time.Time
+	// Source is the file and line the rule was read from, such as "trust.yaml:12"
+	Source string
+}
+
+// trustPolicyFile is the document read by LoadTrustPolicy.
+type trustPolicyFile struct {
+	Trust []yaml.Node `yaml:"trust"`
+}
+
+// trustRuleFields are the fields of a rule as written in the file.
+type trustRuleFields struct {
+	Account          string   `yaml:"account"`
+	OwnerAlias       string   `yaml:"owner_alias"`
+	Label            string   `yaml:"label"`
+	ImageNames       []string `yaml:"image_names"`
+	ImageNameRegex   string   `yaml:"image_name_regex"`
+	Descriptions     []string `yaml:"descriptions"`
+	DescriptionRegex string   `yaml:"description_regex"`
+	Regions          []string `yaml:"regions"`
+	Accounts         []string `yaml:"accounts"`
+	Expires          string   `yaml:"expires"`
+}
+
+// LoadTrustPolicy reads a trust policy from a YAML or JSON file. See ParseTrustPolicy for the format.
+func LoadTrustPolicy(path string) (*TrustPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseTrustPolicy(path, data)
+}
+
+// ParseTrustPolicy parses a trust policy file: a YAML or JSON document with a "trust" list of rules. Each rule has
+// an "account" or an "owner_alias", and optionally a "label", the "image_names" and "descriptions" patterns or the
+// "image_name_regex" and "description_regex" regular expressions the AMI must match, the "regions" and "accounts" it
+// is limited to, and an "expires" date (2006-01-02, midnight UTC) or RFC 3339 time. Regular expressions must match the
+// whole name or description. name is used in error messages, which point at the offending line.
+func ParseTrustPolicy(name string, data []byte) (*TrustPolicy, error) {
+	var file trustPolicyFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, yamlError(name, err)
+	}
+	if len(file.Trust) == 0 {
+		return nil, fmt.Errorf("%s: no trust rules listed", name)
+	}
+
+	policy := &TrustPolicy{}
+	for _, node := range file.Trust {
+		lineErr := func(line int, format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", name, line, fmt.Sprintf(format, args...))
+		}
+		if err := checkFields(name, &node, "account", "owner_alias", "label", "image_names", "image_name_regex",
+			"descriptions", "description_regex", "regions", "accounts", "expires"); err != nil {
+			return nil, err
+		}
+		var fields trustRuleFields
+		if err := node.Decode(&fields); err != nil {
+			return nil, yamlError(name, err)
+		}
+		rule := TrustRule{
+			Account:      fields.Account,
+			OwnerAlias:   fields.OwnerAlias,
+			Label:        fields.Label,
+			ImageNames:   fields.ImageNames,
+			Descriptions: fields.Descriptions,
+			Regions:      fields.Regions,
+			Accounts:     fields.Accounts,
+			Source:       fmt.Sprintf("%s:%d", name, node.Line),
+		}
+		switch {
+		case rule.Account == "" && rule.OwnerAlias == "":
+			return nil, lineErr(node.Line, "a rule needs an account or an owner_alias")
+		case rule.Account != "" && rule.OwnerAlias != "":
+			return nil, lineErr(node.Line, "a rule cannot have both an account and an owner_alias")
+		case rule.Account != "" && !accountIDPattern.MatchString(rule.Account):
+			return nil, lineErr(valueLine(&node, "account", 0), "account ID %q is not 12 digits", rule.Account)
+		}
+		for _, patterns := range []struct {
+			field  string
+			values []string
+		}{{"image_names", rule.ImageNames}, {"descriptions", rule.Descriptions}} {
+			for i, pattern := range patterns.values {
+				if pattern == "" {
+					return nil, lineErr(valueLine(&node, patterns.field, i), "empty pattern")
+				}
+			}
+		}
+		var err error
+		if rule.ImageNameRegex, err = compileWhole(fields.ImageNameRegex); err != nil {
+			return nil, lineErr(valueLine(&node, "image_name_regex", 0), "image_name_regex: %v", err)
+		}
+		if rule.DescriptionRegex, err = compileWhole(fields.DescriptionRegex); err != nil {
+			return nil, lineErr(valueLine(&node, "description_regex", 0), "description_regex: %v", err)
+		}
+		for i, region := range rule.Regions {
+			if region == "" {
+				return nil, lineErr(valueLine(&node, "regions", i), "empty region")
+			}
+		}
+		for i, account := range rule.Accounts {
+			if !accountIDPattern.MatchString(account) {
+				return nil, lineErr(valueLine(&node, "accounts", i), "account ID %q is not 12 digits", account)
+			}
+		}
+		if fields.Expires != "" {
+			expires, err := parseExpiry(fields.Expires)
+			if err != nil {
+				return nil, lineErr(valueLine(&node, "expires", 0), "expires %q is not a date (2006-01-02) or an RFC 3339 time",
+					fields.Expires)
+			}
+			rule.Expires = expires
+		}
+		policy.Rules = append(policy.Rules, rule)
+	}
+	return policy, nil
+}
+
+// parseExpiry parses an expiry date, which is midnight UTC, or an RFC 3339 time.
+func parseExpiry(value string) (time.Time, error) {
+	if expires, err := time.Parse(time.DateOnly, value); err == nil {
+		return expires, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// compileWhole compiles a regular expression that must match the whole text. It returns nil for an empty expression.
+func compileWhole(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	if _, err := regexp.Compile(expr); err != nil {
+		return nil, err
+	}
+	return regexp.Compile(`^(?:` + expr + `)$`)
+}
+
+// matchGlob reports whether text matches pattern as a whole, where * matches any characters, including "/", and ?
+// matches one character.
+func matchGlob(pattern, text string) bool {
+	pat, txt := []rune(pattern), []rune(text)
+	// star is the position in pat after the last *, and retry the position in txt that * is matched up to next
+	star, retry := -1, 0
+	p, t := 0, 0
+	for t < len(txt) {
+		switch {
+		case p < len(pat) && pat[p] == '*':
+			star, retry = p+1, t
+			p++
+		case p < len(pat) && (pat[p] == '?' || pat[p] == txt[t]):
+			p++
+			t++
+		case star >= 0:
+			retry++
+			p, t = star, retry
+		default:
+			return false
+		}
+	}
+	return strings.Trim(string(pat[p:]), "*") == ""
+}
+
+// matchText returns a description of the pattern or regular expression that value matches.
+func matchText(field, value string, patterns []string, re *regexp.Regexp) (string, bool) {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, value) {
+			return fmt.Sprintf("%s matches %q", field, pattern), true
+		}
+	}
+	if re != nil && re.MatchString(value) {
+		return fmt.Sprintf("%s matches %q", field, re), true
+	}
+	return "", false
+}
+
+// valueLine returns the line of the value of key in a mapping node, or of its i-th item when the value is a
+// sequence. It falls back to the line of the mapping.
+func valueLine(node *yaml.Node, key string, i int) int {
+	for j := 0; j+1 < len(node.Content); j += 2 {
+		if node.Content[j].Value != key {
+			continue
+		}
+		value := node.Content[j+1]
+		if value.Kind == yaml.SequenceNode && i < len(value.Content) {
+			return value.Content[i].Line
+		}
+		return value.Line
+	}
+	return node.Line
+}
+
+// Expired reports whether the rule has stopped applying at now.
+func (r TrustRule) Expired(now time.Time) bool {
+	return !r.Expires.IsZero() && !now.Before(r.Expires)
+}
+
+// matches reports whether the rule trusts the AMI when it is used in account at now, along with the name and
+// description patterns the AMI matched.
+func (r TrustRule) matches(ami AMI, account string, now time.Time) ([]string, bool) {
+	if r.OwnerAlias != "" {
+		if ami.OwnerAlias != r.OwnerAlias {
+			return nil, false
+		}
+	} else if ami.OwnerAlias != "" || ami.OwnerID != r.Account {
+		return nil, false
+	}
+	if len(r.Regions) > 0 && !contains(r.Regions, ami.Region) {
+		return nil, false
+	}
+	if len(r.Accounts) > 0 && !contains(r.Accounts, account) {
+		return nil, false
+	}
+	if r.Expired(now) {
+		return nil, false
+	}
+	var matched []string
+	if len(r.ImageNames) > 0 || r.ImageNameRegex != nil {
+		criterion, ok := matchText("name", ami.Name, r.ImageNames, r.ImageNameRegex)
+		if !ok {
+			return nil, false
+		}
+		matched = append(matched, criterion)
+	}
+	if len(r.Descriptions) > 0 || r.DescriptionRegex != nil {
+		criterion, ok := matchText("description", ami.Description, r.Descriptions, r.DescriptionRegex)
+		if !ok {
+			return nil, false
+		}
+		matched = append(matched, criterion)
+	}
+	return matched, true
+}
+
+// reason describes why an AMI matching the rule, and the patterns in matched, is trusted.
+func (r TrustRule) reason(matched []string) string {
+	owner := "owner " + r.Account
+	if r.OwnerAlias != "" {
+		owner = fmt.Sprintf("owner alias %q", r.OwnerAlias)
+	}
+	rule := r.Source
+	if r.Label != "" {
+		rule = fmt.Sprintf("%q (%s)", r.Label, r.Source)
+	}
+	reason := fmt.Sprintf("%s is trusted by trust policy rule %s", owner, rule)
+	if len(matched) > 0 {
+		reason += " as its " + strings.Join(matched, " and ")
+	}
+	if !r.Expires.IsZero() {
+		expires := r.Expires.Format(time.RFC3339)
+		if r.Expires.Equal(r.Expires.Truncate(24 * time.Hour)) {
+			expires = r.Expires.Format(time.DateOnly)
+		}
+		reason += ", expires " + expires
+	}
+	return reason
+}
+
+// Trusts reports whether the policy trusts the AMI when it is used in account at now, along with the reason from
+// the first matching rule.
+func (p *TrustPolicy) Trusts(ami AMI, account string, now time.Time) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	for _, rule := range p.Rules {
+		if matched, ok := rule.matches(ami, account, now); ok {
+			return rule.reason(matched), true
+		}
+	}
+	return "", false
+}
+
+// Expired returns the rules that have stopped applying at now.
+func (p *TrustPolicy) Expired(now time.Time) []TrustRule {
+	if p == nil {
+		return nil
+	}
+	var expired []TrustRule
+	for _, rule := range p.Rules {
+		if rule.Expired(now) {
+			expired = append(expired, rule)
+		}
+	}
+	return expired
+}
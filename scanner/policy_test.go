@@ -0,0 +1,184 @@
+package scanner
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTrustPolicy(t *testing.T) {
+	yamlFile := `
+# Owners trusted on top of Allowed AMIs
+trust:
+  - account: "222222222222"
+    label: Golden image factory
+  - owner_alias: aws-backup-vault
+    accounts: ["111111111111"]
+  # Vendor trial, to be removed when the contract is signed
+  - account: 333333333333
+    regions: [eu-west-1]
+    expires: 2026-06-30
+`
+	want := &TrustPolicy{Rules: []TrustRule{
+		{Account: unknownOwner, Label: "Golden image factory", Source: "trust.yaml:4"},
+		{OwnerAlias: "aws-backup-vault", Accounts: []string{testAccount}, Source: "trust.yaml:6"},
+		{
+			Account: "333333333333",
+			Regions: []string{"eu-west-1"},
+			Expires: time.Date(2026, 6, 30, 0, 0, 0, 0, time.UTC),
+			Source:  "trust.yaml:9",
+		},
+	}}
+	got, err := ParseTrustPolicy("trust.yaml", []byte(yamlFile))
+	if err != nil {
+		t.Fatalf("ParseTrustPolicy() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTrustPolicy() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseTrustPolicyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{"empty", "", "trust.yaml: no trust rules listed"},
+		{"unknown top-level field", "trusted: []", "trust.yaml:1: field trusted not found"},
+		{"unknown field", "trust:\n  - account: \"222222222222\"\n    lable: x\n", `trust.yaml:3: unknown field "lable"`},
+		{"no owner", "trust:\n  - label: x\n", "trust.yaml:2: a rule needs an account or an owner_alias"},
+		{
+			"both owners",
+			"trust:\n  - account: \"222222222222\"\n    owner_alias: aws-backup-vault\n",
+			"trust.yaml:2: a rule cannot have both an account and an owner_alias",
+		},
+		{"short ID", "trust:\n  - label: x\n    account: \"1234\"\n", `trust.yaml:3: account ID "1234" is not 12 digits`},
+		{
+			"scoped account",
+			"trust:\n  - account: \"222222222222\"\n    accounts:\n      - \"111111111111\"\n      - \"11111\"\n",
+			`trust.yaml:5: account ID "11111" is not 12 digits`,
+		},
+		{
+			"empty pattern",
+			"trust:\n  - account: \"222222222222\"\n    image_names: [\"ubuntu/*\", \"\"]\n",
+			"trust.yaml:3: empty pattern",
+		},
+		{
+			"regex",
+			"trust:\n  - account: \"222222222222\"\n    image_name_regex: \"ubuntu/(images\"\n",
+			"trust.yaml:3: image_name_regex: error parsing regexp: missing closing )",
+		},
+		{
+			"expiry",
+			"trust:\n  - account: \"222222222222\"\n    expires: next week\n",
+			`trust.yaml:3: expires "next week" is not a date`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTrustPolicy("trust.yaml", []byte(tt.file))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ParseTrustPolicy() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustPolicyTrusts(t *testing.T) {
+	now := time.Date(2026, 7, 1, 12, 0, 0, 0, time.UTC)
+	policy := &TrustPolicy{Rules: []TrustRule{
+		{Account: unknownOwner, Regions: []string{"eu-west-1"}, Source: "trust.yaml:2"},
+		{Account: "333333333333", Expires: time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), Source: "trust.yaml:4"},
+		{Account: "444444444444", Label: "Vendor", Expires: time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC), Source: "trust.yaml:6"},
+		{OwnerAlias: "aws-backup-vault", Accounts: []string{testAccount}, Source: "trust.yaml:9"},
+	}}
+	tests := []struct {
+		name       string
+		ami        AMI
+		account    string
+		wantReason string
+	}{
+		{"in scoped region", AMI{OwnerID: unknownOwner, Region: "eu-west-1"}, testAccount,
+			"owner 222222222222 is trusted by trust policy rule trust.yaml:2"},
+		{"outside scoped region", AMI{OwnerID: unknownOwner, Region: "us-east-1"}, testAccount, ""},
+		{"expired", AMI{OwnerID: "333333333333", Region: "us-east-1"}, testAccount, ""},
+		{"not expired yet", AMI{OwnerID: "444444444444", Region: "us-east-1"}, testAccount,
+			`owner 444444444444 is trusted by trust policy rule "Vendor" (trust.yaml:6), expires 2026-08-01`},
+		{"alias in scoped account", AMI{OwnerAlias: "aws-backup-vault", OwnerID: "555555555555"}, testAccount,
+			`owner alias "aws-backup-vault" is trusted`},
+		{"alias outside scoped account", AMI{OwnerAlias: "aws-backup-vault", OwnerID: "555555555555"}, "666666666666", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, ok := policy.Trusts(tt.ami, tt.account, now)
+			if ok != (tt.wantReason != "") || !strings.Contains(reason, tt.wantReason) {
+				t.Errorf("Trusts() = %q, %v, want %q", reason, ok, tt.wantReason)
+			}
+		})
+	}
+
+	if expired := policy.Expired(now); len(expired) != 1 || expired[0].Source != "trust.yaml:4" {
+		t.Errorf("Expired() = %+v, want the rule of trust.yaml:4", expired)
+	}
+}
+
+func TestTrustPolicyImageCriteria(t *testing.T) {
+	policy, err := ParseTrustPolicy("trust.yaml", []byte(`
+trust:
+  - account: "099720109477"
+    label: Canonical
+    image_names: ["ubuntu/images/*", "ubuntu-pro-server/images/*"]
+  - account: "222222222222"
+    image_name_regex: golden-(web|db)-[0-9]+
+    descriptions: ["Built by Packer *"]
+`))
+	if err != nil {
+		t.Fatalf("ParseTrustPolicy() error = %v", err)
+	}
+	tests := []struct {
+		name       string
+		ami        AMI
+		wantReason string
+	}{
+		{"matching name", AMI{OwnerID: canonicalOwner, Name: "ubuntu/images/hvm-ssd/ubuntu-jammy-22.04-amd64-server-20240207"},
+			`owner 099720109477 is trusted by trust policy rule "Canonical" (trust.yaml:3) as its name matches "ubuntu/images/*"`},
+		{"other name of the owner", AMI{OwnerID: canonicalOwner, Name: "ubuntu-minimal/images/hvm-ssd/ubuntu-jammy"}, ""},
+		{"matching name of another owner", AMI{OwnerID: unknownOwner, Name: "ubuntu/images/hvm-ssd/ubuntu-jammy"}, ""},
+		{"matching regex and description", AMI{OwnerID: unknownOwner, Name: "golden-db-42", Description: "Built by Packer 1.11"},
+			`as its name matches "^(?:golden-(web|db)-[0-9]+)$" and description matches "Built by Packer *"`},
+		{"regex matches part of the name", AMI{OwnerID: unknownOwner, Name: "not-golden-db-42", Description: "Built by Packer 1.11"}, ""},
+		{"description does not match", AMI{OwnerID: unknownOwner, Name: "golden-web-1", Description: "Built by hand"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, ok := policy.Trusts(tt.ami, testAccount, time.Now())
+			if ok != (tt.wantReason != "") || !strings.Contains(reason, tt.wantReason) {
+				t.Errorf("Trusts() = %q, %v, want %q", reason, ok, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, text string
+		want          bool
+	}{
+		{"ubuntu/images/*", "ubuntu/images/hvm-ssd/ubuntu-jammy", true},
+		{"ubuntu/images/*", "ubuntu/images/", true},
+		{"ubuntu/images/*", "xubuntu/images/hvm", false},
+		{"al2023-ami-2023.?.*-x86_64", "al2023-ami-2023.6.20241212.0-kernel-6.1-x86_64", true},
+		{"al2023-ami-2023.?.*-x86_64", "al2023-ami-2023.6.20241212.0-kernel-6.1-arm64", false},
+		{"*-*-*", "a-b-c", true},
+		{"*", "", true},
+		{"?", "é", true},
+		{"exact", "exact-not", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.text); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.text, got, tt.want)
+		}
+	}
+}
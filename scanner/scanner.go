@@ -0,0 +1,378 @@
+// Package scanner finds EC2 instances launched from untrusted AMIs and classifies the AMIs they were launched from.
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/bishopfox/knownawsaccountslookup"
+	"github.com/fatih/color"
+)
+
+var (
+	green  = color.New(color.FgGreen)
+	yellow = color.New(color.FgYellow)
+	red    = color.New(color.FgRed)
+	cyan   = color.New(color.FgCyan)
+)
+
+// Options controls what a Scanner scans and how it reports progress.
+type Options struct {
+	// Regions to scan. When empty, every region returned by ec2:DescribeRegions is scanned.
+	Regions []string
+	// TrustedAccounts are account IDs the user trusts to share AMIs
+	TrustedAccounts []string
+	// TrustPolicy holds the trust rules read from a trust policy file, see LoadTrustPolicy. It may be nil.
+	TrustPolicy *TrustPolicy
+	// Organization holds the accounts of the user's AWS Organization whose AMIs are trusted, see
+	// LoadOrganizationTrust. When nil, organization membership is not considered.
+	Organization *OrganizationTrust
+	// Vendors is used to put a name on the owner of unverified AMIs. When nil, the community list of known AWS
+	// accounts is loaded.
+	Vendors *knownawsaccountslookup.Vendors
+	// Verbose reports the classification of every AMI instead of only the unverified ones
+	Verbose bool
+	// Progress receives human-readable progress messages. When nil, progress is discarded.
+	Progress io.Writer
+	// Logger receives warnings about failed AWS calls, along with their request IDs. When nil, they are discarded.
+	Logger *slog.Logger
+	// Concurrency is the maximum number of regions, and of AMI lookups within a region, processed at once.
+	// Values below 1 scan one region at a time.
+	Concurrency int
+
+	// NewEC2Client returns the EC2 client to use for a region. When nil, clients are built from the AWS config
+	// passed to New.
+	NewEC2Client func(region string) EC2API
+	// STSClient is used to look up the caller identity. When nil, it is built from the AWS config passed to New.
+	STSClient STSAPI
+}
+
+// Scanner scans the account behind an AWS config for instances launched from untrusted AMIs.
+type Scanner struct {
+	cfg      aws.Config
+	opts     Options
+	out      io.Writer
+	logger   *slog.Logger
+	identity *Identity
+}
+
+// New returns a Scanner using the credentials in cfg.
+func New(cfg aws.Config, opts Options) *Scanner {
+	if opts.Vendors == nil {
+		opts.Vendors = knownawsaccountslookup.NewVendorMap()
+		opts.Vendors.PopulateKnownAWSAccounts()
+	}
+	out := opts.Progress
+	if out == nil {
+		out = io.Discard
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &Scanner{cfg: cfg, opts: opts, out: out, logger: logger}
+}
+
+// Identity returns the caller identity of the scanner's credentials. The result is cached.
+func (s *Scanner) Identity(ctx context.Context) (*Identity, error) {
+	if s.identity != nil {
+		return s.identity, nil
+	}
+	callerIdentity, err := s.stsClient().GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	s.identity = &Identity{
+		Account: aws.ToString(callerIdentity.Account),
+		Arn:     aws.ToString(callerIdentity.Arn),
+	}
+	return s.identity, nil
+}
+
+// Regions returns the regions the scanner will scan.
+func (s *Scanner) Regions(ctx context.Context) ([]string, error) {
+	if len(s.opts.Regions) > 0 {
+		return s.opts.Regions, nil
+	}
+	describeRegionsOutput, err := s.ec2Client(s.cfg.Region).DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe regions: %w", err)
+	}
+	var regions []string
+	for _, r := range describeRegionsOutput.Regions {
+		regions = append(regions, *r.RegionName)
+	}
+	return regions, nil
+}
+
+// Scan enumerates the instances in every region and classifies the AMIs they were launched from. Up to
+// Options.Concurrency regions are scanned at once; results and progress are merged in region order, so they do not
+// depend on which region finishes first.
+func (s *Scanner) Scan(ctx context.Context) (*Result, error) {
+	identity, err := s.Identity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	regions, err := s.Regions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newResult()
+	result.Identity = *identity
+	result.Accounts = []string{identity.Account}
+	for _, region := range regions {
+		result.Regions = append(result.Regions, RegionKey{Account: identity.Account, Region: region})
+	}
+	result.ScannedAt = time.Now().UTC()
+
+	scans := make([]*regionScan, len(regions))
+	done := make([]chan struct{}, len(regions))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	go forEach(len(regions), s.concurrency(), func(i int) {
+		scans[i] = s.scanRegion(ctx, regions[i], identity.Account)
+		close(done[i])
+	})
+	for i := range regions {
+		<-done[i]
+		s.merge(scans[i], result)
+	}
+	return result, nil
+}
+
+func (s *Scanner) concurrency() int {
+	if s.opts.Concurrency < 1 {
+		return 1
+	}
+	return s.opts.Concurrency
+}
+
+// regionScan holds what was found in a single region before it is merged into the Result.
+type regionScan struct {
+	account            string
+	region             string
+	allowedAMIsState   string
+	allowedAMIAccounts []string
+	allowedAMIsErr     error
+	instances          []launchedInstance
+	// amiIDs are the distinct AMIs the region's instances were launched from, in the order they were found
+	amiIDs []string
+	amis   map[string]AMI
+	errs   []ScanError
+	// out buffers the region's progress messages until it is merged
+	out *syncBuffer
+}
+
+func (s *Scanner) scanRegion(ctx context.Context, region, account string) *regionScan {
+	rs := &regionScan{account: account, region: region, out: &syncBuffer{}}
+	ec2Client := s.ec2Client(region)
+
+	rs.allowedAMIsState, rs.allowedAMIAccounts, rs.allowedAMIsErr = CheckAllowedAMIs(ctx, ec2Client)
+	if rs.allowedAMIsErr == nil && s.opts.Verbose {
+		switch rs.allowedAMIsState {
+		case "enabled":
+			fmt.Fprintf(rs.out, "[*] [%s] Allowed AMI Accounts status: %s\n", region, green.Sprint("Enabled"))
+		case "audit-mode":
+			fmt.Fprintf(rs.out, "[*] [%s] Allowed AMI Accounts status: %s\n", region, yellow.Sprint("Audit mode"))
+		default:
+			fmt.Fprintf(rs.out, "[*] [%s] Allowed AMI Accounts status: %s\n", region, red.Sprint("Disabled"))
+		}
+	}
+
+	instances, err := listInstances(ctx, ec2Client, region)
+	if err != nil {
+		s.logger.Warn("Error fetching instances", "region", region, "request_id", RequestID(err), "error", err)
+		rs.errs = append(rs.errs, ScanError{Region: region, Operation: "DescribeInstances", Err: err})
+		return rs
+	}
+	rs.instances = instances
+
+	// Only the first instance launched from each AMI is needed to look it up
+	instanceByAMI := make(map[string]string)
+	for _, instance := range instances {
+		if _, ok := instanceByAMI[instance.amiID]; !ok {
+			rs.amiIDs = append(rs.amiIDs, instance.amiID)
+			instanceByAMI[instance.amiID] = instance.ID
+		}
+	}
+
+	amis, errs := s.describeAMIs(ctx, rs.out, ec2Client, region, rs.amiIDs, instanceByAMI)
+	rs.errs = append(rs.errs, errs...)
+	rs.amis = make(map[string]AMI, len(amis))
+	for i, amiID := range rs.amiIDs {
+		ami, ok := amis[amiID]
+		if !ok {
+			continue
+		}
+		ami.Account = account
+		progress := fmt.Sprintf("[%d/%d][%s] %s", i+1, len(rs.amiIDs), region, amiID)
+		rs.amis[amiID] = s.classify(rs.out, ami, progress, ClassificationContext{
+			Account:            account,
+			AllowedAMIsState:   rs.allowedAMIsState,
+			AllowedAMIAccounts: rs.allowedAMIAccounts,
+			TrustedAccounts:    s.opts.TrustedAccounts,
+			TrustPolicy:        s.opts.TrustPolicy,
+			Organization:       s.opts.Organization,
+		})
+	}
+	return rs
+}
+
+// merge adds a region's findings to the result and writes out the region's progress messages.
+func (s *Scanner) merge(rs *regionScan, result *Result) {
+	region := rs.region
+	regionKey := RegionKey{Account: rs.account, Region: region}
+	result.AllowedAMIStateByRegion[regionKey] = rs.allowedAMIsState
+	result.AllowedAMIAccountsByRegion[regionKey] = rs.allowedAMIAccounts
+	if err := rs.allowedAMIsErr; err != nil {
+		if strings.Contains(err.Error(), "UnauthorizedOperation") {
+			if !result.AllowedAMIPermissionDenied {
+				s.logger.Warn("Permission denied calling ec2:GetAllowedImagesSettings. Skipping allowed AMI checks for all regions",
+					"arn", result.Identity.Arn, "request_id", RequestID(err))
+				result.AllowedAMIPermissionDenied = true
+			}
+		} else {
+			s.logger.Warn("Error calling ec2:GetAllowedImagesSettings", "region", region, "request_id", RequestID(err),
+				"error", err)
+			result.Errors = append(result.Errors, ScanError{Account: rs.account, Region: region,
+				Operation: "GetAllowedImagesSettings", Err: err})
+		}
+	}
+	rs.out.WriteTo(s.out)
+	for _, scanErr := range rs.errs {
+		scanErr.Account = rs.account
+		result.Errors = append(result.Errors, scanErr)
+	}
+
+	for _, instance := range rs.instances {
+		instance.Account = rs.account
+		key := AMIKey{Account: rs.account, Region: region, ID: instance.amiID}
+		// Check if the instance already exists in the map
+		exists := false
+		for _, inst := range result.AMIToInstances[key] {
+			if inst.ID == instance.ID {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			result.AMIToInstances[key] = append(result.AMIToInstances[key], instance.Instance)
+		}
+	}
+	result.TotalInstances += len(rs.instances)
+
+	for _, amiID := range rs.amiIDs {
+		result.ProcessedAMIs[AMIKey{Account: rs.account, Region: region, ID: amiID}] = true
+		if ami, ok := rs.amis[amiID]; ok {
+			result.add(ami)
+		}
+	}
+}
+
+// launchedInstance is an instance along with the ID of the AMI it was launched from.
+type launchedInstance struct {
+	Instance
+	amiID string
+}
+
+// listInstances returns every instance in a region, following ec2:DescribeInstances pagination.
+func listInstances(ctx context.Context, ec2Client EC2API, region string) ([]launchedInstance, error) {
+	var instances []launchedInstance
+	paginator := ec2.NewDescribeInstancesPaginator(ec2Client, &ec2.DescribeInstancesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				name := ""
+				// Get the name of the instance if it exists from the tags
+				for _, tag := range instance.Tags {
+					if aws.ToString(tag.Key) == "Name" {
+						name = aws.ToString(tag.Value)
+					}
+				}
+				instances = append(instances, launchedInstance{
+					Instance: Instance{
+						ID:     aws.ToString(instance.InstanceId),
+						Region: region,
+						Name:   name,
+					},
+					amiID: aws.ToString(instance.ImageId),
+				})
+			}
+		}
+	}
+	return instances, nil
+}
+
+// vendorName looks up the vendor name of an account, returning AmiOwnerNameUnknown if it is not a known vendor
+func (s *Scanner) vendorName(accountID string) string {
+	ownerName := s.opts.Vendors.GetVendorNameFromAccountID(accountID)
+	if ownerName == "" {
+		ownerName = AmiOwnerNameUnknown
+	}
+	return ownerName
+}
+
+// classify sets the status of an AMI and reports it to out. Only unverified AMIs are reported unless the scanner
+// is verbose.
+func (s *Scanner) classify(out io.Writer, ami AMI, progress string, ctx ClassificationContext) AMI {
+	ami.Status, ami.Reason = Classify(ami, ctx)
+
+	switch ami.Status {
+	case StatusUnverified:
+		red.Fprintf(out, "%s is %s: %s\n", progress, ami.Status, ami.Reason)
+	case StatusPrivateShared, StatusUnverifiedButKnown:
+		if s.opts.Verbose {
+			yellow.Fprintf(out, "%s is %s: %s\n", progress, ami.Status, ami.Reason)
+		}
+	default:
+		if s.opts.Verbose {
+			green.Fprintf(out, "%s is %s: %s\n", progress, ami.Status, ami.Reason)
+		}
+	}
+	return ami
+}
+
+// CheckAllowedAMIs returns the state of the "Allowed AMIs" setting in the client's region and the image providers
+// (account IDs or aliases) that it allows.
+func CheckAllowedAMIs(ctx context.Context, client EC2API) (string, []string, error) {
+	// Check if the region supports allowedAMIs
+	GetAllowedImagesOutput, err := client.GetAllowedImagesSettings(ctx, &ec2.GetAllowedImagesSettingsInput{})
+
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get allowed AMIs settings: %w", err)
+
+	}
+	var ImageCriteria []types.ImageCriterion
+	var ImageProviders []string
+
+	ImageCriteria = GetAllowedImagesOutput.ImageCriteria
+	for _, ImageCriteria := range ImageCriteria {
+		ImageProviders = append(ImageProviders, ImageCriteria.ImageProviders...)
+	}
+
+	return *GetAllowedImagesOutput.State, ImageProviders, nil
+}
+
+// Returns true of a string is in the given list of strings. Else false
+func contains(slice []string, item string) bool {
+	for _, a := range slice {
+		if a == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,444 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/bishopfox/knownawsaccountslookup"
+)
+
+const (
+	testAccount    = "111111111111"
+	testRegion     = "us-east-1"
+	canonicalOwner = "099720109477"
+	unknownOwner   = "222222222222"
+)
+
+func testVendors() *knownawsaccountslookup.Vendors {
+	return &knownawsaccountslookup.Vendors{
+		{Name: "Canonical", Accounts: knownawsaccountslookup.ListOrString{Values: []string{canonicalOwner}}},
+	}
+}
+
+func image(id, owner, alias string, public bool) types.Image {
+	image := types.Image{
+		ImageId:     aws.String(id),
+		OwnerId:     aws.String(owner),
+		Public:      aws.Bool(public),
+		Name:        aws.String(id + "-name"),
+		Description: aws.String(id + "-description"),
+	}
+	if alias != "" {
+		image.ImageOwnerAlias = aws.String(alias)
+	}
+	return image
+}
+
+// category returns the name of the result category an AMI was sorted into in a region.
+func category(result *Result, region, amiID string) string {
+	categories := map[string]map[AMIKey]AMI{
+		"verified":             result.VerifiedAMIs,
+		"self hosted":          result.SelfHostedAMIs,
+		"allowed":              result.AllowedAMIs,
+		"trusted":              result.TrustedAMIs,
+		"private shared":       result.PrivateSharedAMIs,
+		"unknown":              result.UnknownAMIs,
+		"unverified but known": result.UnverifiedButKnownAMIs,
+		"unverified":           result.UnverifiedAMIs,
+	}
+	found := ""
+	for name, amis := range categories {
+		if _, ok := amis[AMIKey{Account: result.Identity.Account, Region: region, ID: amiID}]; ok {
+			if found != "" {
+				return "multiple"
+			}
+			found = name
+		}
+	}
+	return found
+}
+
+func TestScanClassification(t *testing.T) {
+	tests := []struct {
+		name string
+		// image is the AMI visible to ec2:DescribeImages. When nil, metadata is used instead.
+		image            *types.Image
+		metadata         *types.ImageMetadata
+		allowedState     string
+		allowedProviders []string
+		trustedAccounts  []string
+		organization     *OrganizationTrust
+		want             string
+	}{
+		{
+			name:  "amazon owned AMI is verified",
+			image: ptrTo(image("ami-1", "137112412989", "amazon", true)),
+			want:  "verified",
+		},
+		{
+			name:  "marketplace AMI is verified",
+			image: ptrTo(image("ami-1", "679593333241", "aws-marketplace", true)),
+			want:  "verified",
+		},
+		{
+			name:  "AMI with self alias is self hosted",
+			image: ptrTo(image("ami-1", testAccount, "self", false)),
+			want:  "self hosted",
+		},
+		{
+			name:  "private AMI owned by the caller is self hosted",
+			image: ptrTo(image("ami-1", testAccount, "", false)),
+			want:  "self hosted",
+		},
+		{
+			name:             "AMI from an allowed account is allowed",
+			image:            ptrTo(image("ami-1", unknownOwner, "", true)),
+			allowedState:     "enabled",
+			allowedProviders: []string{unknownOwner},
+			want:             "allowed",
+		},
+		{
+			name:             "allowed accounts are honoured in audit mode",
+			image:            ptrTo(image("ami-1", unknownOwner, "", false)),
+			allowedState:     "audit-mode",
+			allowedProviders: []string{unknownOwner},
+			want:             "allowed",
+		},
+		{
+			name:             "allowed accounts are ignored when Allowed AMIs is disabled",
+			image:            ptrTo(image("ami-1", unknownOwner, "", true)),
+			allowedState:     "disabled",
+			allowedProviders: []string{unknownOwner},
+			want:             "unverified",
+		},
+		{
+			name:            "AMI from a trusted account is trusted",
+			image:           ptrTo(image("ami-1", unknownOwner, "", false)),
+			trustedAccounts: []string{unknownOwner},
+			want:            "trusted",
+		},
+		{
+			name:         "AMI from an account of the trusted organization is trusted",
+			image:        ptrTo(image("ami-1", unknownOwner, "", false)),
+			organization: &OrganizationTrust{ID: "o-a1b2c3d4e5", Accounts: map[string]string{unknownOwner: ""}},
+			want:         "trusted",
+		},
+		{
+			name:  "private AMI from another account is private shared",
+			image: ptrTo(image("ami-1", unknownOwner, "", false)),
+			want:  "private shared",
+		},
+		{
+			name:  "public AMI from a known vendor is unverified but known",
+			image: ptrTo(image("ami-1", canonicalOwner, "", true)),
+			want:  "unverified but known",
+		},
+		{
+			name:  "public AMI from an unknown account is unverified",
+			image: ptrTo(image("ami-1", unknownOwner, "", true)),
+			want:  "unverified",
+		},
+		{
+			name:  "AMI with an unrecognized owner alias is unknown",
+			image: ptrTo(image("ami-1", unknownOwner, "aws-backup-vault", false)),
+			want:  "unknown",
+		},
+		{
+			name: "AMI missing from DescribeImages falls back to instance metadata",
+			metadata: &types.ImageMetadata{
+				ImageId:         aws.String("ami-1"),
+				OwnerId:         aws.String(unknownOwner),
+				ImageOwnerAlias: aws.String(unknownOwner),
+				IsPublic:        aws.Bool(true),
+				Name:            aws.String("ami-1-name"),
+			},
+			want: "unverified",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeEC2()
+			fake.addInstance("i-1", "ami-1", "web")
+			if tt.image != nil {
+				fake.addImage(*tt.image)
+			}
+			if tt.metadata != nil {
+				fake.imageMetadata["i-1"] = *tt.metadata
+			}
+			if tt.allowedState != "" {
+				fake.allowedState = tt.allowedState
+			}
+			fake.allowedProviders = tt.allowedProviders
+
+			s := newFakeScanner(testAccount, map[string]*fakeEC2{testRegion: fake}, Options{
+				TrustedAccounts: tt.trustedAccounts,
+				Organization:    tt.organization,
+				Vendors:         testVendors(),
+			})
+			result, err := s.Scan(context.Background())
+			if err != nil {
+				t.Fatalf("Scan() error = %v", err)
+			}
+			if got := category(result, testRegion, "ami-1"); got != tt.want {
+				t.Errorf("AMI classified as %q, want %q", got, tt.want)
+			}
+			if result.TotalInstances != 1 {
+				t.Errorf("TotalInstances = %d, want 1", result.TotalInstances)
+			}
+			instances := result.AMIToInstances[AMIKey{Account: testAccount, Region: testRegion, ID: "ami-1"}]
+			if len(instances) != 1 || instances[0].ID != "i-1" || instances[0].Name != "web" || instances[0].Region != testRegion {
+				t.Errorf("AMIToInstances[ami-1] = %+v, want [{i-1 %s web}]", instances, testRegion)
+			}
+		})
+	}
+}
+
+func TestScanDiscoversRegions(t *testing.T) {
+	fakes := map[string]*fakeEC2{
+		"us-east-1": newFakeEC2(),
+		"eu-west-1": newFakeEC2(),
+	}
+	fakes["eu-west-1"].allowedState = "enabled"
+
+	s := newFakeScanner(testAccount, fakes, Options{Vendors: testVendors()})
+	result, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(result.Regions) != 2 {
+		t.Fatalf("Regions = %v, want 2 regions", result.Regions)
+	}
+	enabled, audit, disabled := result.CountRegionsWithAllowedAmisEnabled()
+	if enabled != 1 || audit != 0 || disabled != 1 {
+		t.Errorf("CountRegionsWithAllowedAmisEnabled() = %d/%d/%d, want 1/0/1", enabled, audit, disabled)
+	}
+}
+
+func TestScanPaginatesInstances(t *testing.T) {
+	fake := newFakeEC2()
+	fake.instancesPageSize = 2
+	fake.addImage(image("ami-1", unknownOwner, "", true))
+	fake.addImage(image("ami-2", "137112412989", "amazon", true))
+	for _, id := range []string{"i-1", "i-2", "i-3", "i-4", "i-5"} {
+		fake.addInstance(id, "ami-1", "")
+	}
+	fake.addInstance("i-6", "ami-2", "")
+
+	s := newFakeScanner(testAccount, map[string]*fakeEC2{testRegion: fake}, Options{Vendors: testVendors()})
+	result, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if result.TotalInstances != 6 {
+		t.Errorf("TotalInstances = %d, want 6", result.TotalInstances)
+	}
+	if got := len(result.AMIToInstances[AMIKey{Account: testAccount, Region: testRegion, ID: "ami-1"}]); got != 5 {
+		t.Errorf("len(AMIToInstances[ami-1]) = %d, want 5", got)
+	}
+	if got := category(result, testRegion, "ami-2"); got != "verified" {
+		t.Errorf("ami-2 on the last page classified as %q, want verified", got)
+	}
+	// 3 pages and no per-instance lookups
+	if got := fake.calls["DescribeInstances"]; got != 3 {
+		t.Errorf("DescribeInstances called %d times, want 3", got)
+	}
+}
+
+func TestScanBatchesImageLookups(t *testing.T) {
+	fake := newFakeEC2()
+	for i := 0; i < 250; i++ {
+		amiID := fmt.Sprintf("ami-%d", i)
+		fake.addInstance(fmt.Sprintf("i-%d", i), amiID, "")
+		fake.addInstance(fmt.Sprintf("i-%d-b", i), amiID, "")
+		if i == 42 {
+			// Deleted AMI that is only visible through the instance metadata
+			fake.imageMetadata["i-42"] = types.ImageMetadata{
+				ImageId:  aws.String(amiID),
+				OwnerId:  aws.String(unknownOwner),
+				IsPublic: aws.Bool(false),
+			}
+			continue
+		}
+		fake.addImage(image(amiID, unknownOwner, "", true))
+	}
+
+	s := newFakeScanner(testAccount, map[string]*fakeEC2{testRegion: fake}, Options{Vendors: testVendors()})
+	result, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if got := len(result.UnverifiedAMIs); got != 249 {
+		t.Errorf("len(UnverifiedAMIs) = %d, want 249", got)
+	}
+	if got := category(result, testRegion, "ami-42"); got != "private shared" {
+		t.Errorf("ami-42 classified as %q, want private shared", got)
+	}
+	if got, want := fake.imageBatches, []int{200, 50}; !slices.Equal(got, want) {
+		t.Errorf("DescribeImages batches = %v, want %v", got, want)
+	}
+	if got := fake.calls["DescribeInstanceImageMetadata"]; got != 1 {
+		t.Errorf("DescribeInstanceImageMetadata called %d times, want 1", got)
+	}
+}
+
+func TestScanConcurrentRegionsIsDeterministic(t *testing.T) {
+	newFakes := func() map[string]*fakeEC2 {
+		fakes := make(map[string]*fakeEC2)
+		for i, region := range []string{"ap-south-1", "eu-west-1", "us-east-1", "us-west-2"} {
+			fake := newFakeEC2()
+			// ami-shared is used in every region but its owner is only allowed in the first one
+			fake.addInstance(fmt.Sprintf("i-shared-%d", i), "ami-shared", "")
+			fake.addImage(image("ami-shared", unknownOwner, "", true))
+			if i == 0 {
+				fake.allowedState = "enabled"
+				fake.allowedProviders = []string{unknownOwner}
+			}
+			fake.addInstance(fmt.Sprintf("i-%d", i), fmt.Sprintf("ami-%d", i), "")
+			fake.addImage(image(fmt.Sprintf("ami-%d", i), unknownOwner, "", true))
+			fakes[region] = fake
+		}
+		return fakes
+	}
+
+	var progress [2]bytes.Buffer
+	var results [2]*Result
+	for i, concurrency := range []int{1, 4} {
+		s := newFakeScanner(testAccount, newFakes(), Options{
+			Vendors:     testVendors(),
+			Verbose:     true,
+			Progress:    &progress[i],
+			Concurrency: concurrency,
+		})
+		result, err := s.Scan(context.Background())
+		if err != nil {
+			t.Fatalf("Scan() with concurrency %d error = %v", concurrency, err)
+		}
+		// The scan time is the only field expected to differ between runs
+		result.ScannedAt = time.Time{}
+		results[i] = result
+	}
+
+	if !reflect.DeepEqual(results[0], results[1]) {
+		t.Errorf("concurrent scan result differs from sequential scan:\n%+v\n%+v", results[1], results[0])
+	}
+	if progress[0].String() != progress[1].String() {
+		t.Errorf("concurrent scan progress differs from sequential scan:\n%s\n%s", progress[1].String(), progress[0].String())
+	}
+	if got := category(results[1], "ap-south-1", "ami-shared"); got != "allowed" {
+		t.Errorf("ami-shared classified as %q in ap-south-1, want allowed", got)
+	}
+	if got := category(results[1], "us-east-1", "ami-shared"); got != "unverified" {
+		t.Errorf("ami-shared classified as %q in us-east-1, want unverified", got)
+	}
+	if got := len(results[1].AMIToInstances[AMIKey{Account: testAccount, Region: "us-east-1", ID: "ami-shared"}]); got != 1 {
+		t.Errorf("len(AMIToInstances[us-east-1/ami-shared]) = %d, want 1", got)
+	}
+	if got := len(results[1].ProcessedAMIs); got != 8 {
+		t.Errorf("len(ProcessedAMIs) = %d, want 8", got)
+	}
+}
+
+func TestScanReportsFailuresAsIncomplete(t *testing.T) {
+	throttled := &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusServiceUnavailable}},
+			Err:      errors.New("api error RequestLimitExceeded: Request limit exceeded."),
+		},
+		RequestID: "request-throttled",
+	}
+
+	healthy := newFakeEC2()
+	healthy.addInstance("i-1", "ami-1", "")
+	healthy.addImage(image("ami-1", unknownOwner, "", true))
+
+	noInstances := newFakeEC2()
+	noInstances.describeInstancesErr = throttled
+
+	noMetadata := newFakeEC2()
+	noMetadata.addInstance("i-2", "ami-2", "")
+	noMetadata.addInstance("i-3", "ami-3", "")
+	noMetadata.addImage(image("ami-3", unknownOwner, "", true))
+	noMetadata.imageMetadataErr = throttled
+
+	// ami-4 is still classified from the instance metadata, without the details only ec2:DescribeImages returns
+	noImages := newFakeEC2()
+	noImages.addInstance("i-4", "ami-4", "")
+	noImages.addImage(image("ami-4", unknownOwner, "", true))
+	noImages.imageMetadata["i-4"] = types.ImageMetadata{
+		ImageId:  aws.String("ami-4"),
+		OwnerId:  aws.String(unknownOwner),
+		IsPublic: aws.Bool(true),
+	}
+	noImages.describeImagesErr = throttled
+
+	noSettings := newFakeEC2()
+	noSettings.allowedErr = throttled
+
+	var logs bytes.Buffer
+	s := newFakeScanner(testAccount, map[string]*fakeEC2{
+		"ap-southeast-2": noSettings,
+		"ca-central-1":   noImages,
+		"eu-west-1":      noInstances,
+		"us-east-1":      healthy,
+		"us-west-2":      noMetadata,
+	}, Options{Vendors: testVendors(), Logger: slog.New(slog.NewJSONHandler(&logs, nil))})
+	result, err := s.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	if !result.Incomplete() {
+		t.Fatal("Incomplete() = false, want true")
+	}
+	if got, want := result.IncompleteRegions(), []RegionKey{
+		{testAccount, "ap-southeast-2"}, {testAccount, "ca-central-1"}, {testAccount, "eu-west-1"}, {testAccount, "us-west-2"},
+	}; !slices.Equal(got, want) {
+		t.Errorf("IncompleteRegions() = %v, want %v", got, want)
+	}
+	if len(result.Errors) != 4 {
+		t.Fatalf("Errors = %v, want 4 errors", result.Errors)
+	}
+	for _, scanErr := range result.Errors {
+		if !errors.Is(scanErr, throttled) {
+			t.Errorf("error %v does not wrap the API error", scanErr)
+		}
+		if got := RequestID(scanErr); got != "request-throttled" {
+			t.Errorf("RequestID(%v) = %q, want request-throttled", scanErr, got)
+		}
+		if scanErr.Region == "us-west-2" && !slices.Equal(scanErr.Resources, []string{"ami-2"}) {
+			t.Errorf("us-west-2 error resources = %v, want [ami-2]", scanErr.Resources)
+		}
+		if scanErr.Region == "ap-southeast-2" && scanErr.Operation != "GetAllowedImagesSettings" {
+			t.Errorf("ap-southeast-2 error operation = %q, want GetAllowedImagesSettings", scanErr.Operation)
+		}
+		if scanErr.Region == "ca-central-1" && (scanErr.Operation != "DescribeImages" || !slices.Equal(scanErr.Resources, []string{"ami-4"})) {
+			t.Errorf("ca-central-1 error = %s for %v, want DescribeImages for [ami-4]", scanErr.Operation, scanErr.Resources)
+		}
+	}
+	if got := category(result, "us-west-2", "ami-3"); got != "unverified" {
+		t.Errorf("ami-3 classified as %q, want unverified", got)
+	}
+	if got := category(result, "ca-central-1", "ami-4"); got != "unverified" {
+		t.Errorf("ami-4 classified as %q, want unverified", got)
+	}
+	if got := bytes.Count(logs.Bytes(), []byte(`"request_id":"request-throttled"`)); got != 4 {
+		t.Errorf("logged %d failures with their request ID, want 4:\n%s", got, logs.String())
+	}
+}
+
+func ptrTo[T any](v T) *T {
+	return &v
+}
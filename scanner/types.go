@@ -0,0 +1,306 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	AmiOwnerNameUnknown = "Unknown"
+)
+
+type AMI struct {
+	ID string
+	// Account is the scanned account the AMI is used in, which is not necessarily its owner
+	Account     string
+	Region      string
+	OwnerAlias  string
+	OwnerID     string
+	OwnerName   string
+	Name        string
+	Description string
+	Public      string
+
+	// Status is the whoAMI status of the AMI and Reason explains which classification rule picked it
+	Status Status
+	Reason string
+}
+
+type Instance struct {
+	ID      string
+	Account string
+	Region  string
+	Name    string
+}
+
+// Identity is the AWS principal the scan runs as.
+type Identity struct {
+	Account string
+	Arn     string
+}
+
+// Partition returns the AWS partition of the identity, such as "aws" or "aws-cn", taken from its ARN.
+func (i Identity) Partition() string {
+	if parts := strings.SplitN(i.Arn, ":", 3); len(parts) == 3 && parts[0] == "arn" && parts[1] != "" {
+		return parts[1]
+	}
+	return "aws"
+}
+
+// RegionKey identifies a region of a scanned account. "Allowed AMIs" is configured per region of each account.
+type RegionKey struct {
+	Account string
+	Region  string
+}
+
+// AMIKey identifies an AMI within a region of a scanned account. The same AMI ID can be classified differently in two
+// regions or two accounts, since "Allowed AMIs" is configured per region and the owner may be one of the accounts.
+type AMIKey struct {
+	Account string
+	Region  string
+	ID      string
+}
+
+// Key returns the key of the AMI in the result maps.
+func (a AMI) Key() AMIKey {
+	return AMIKey{Account: a.Account, Region: a.Region, ID: a.ID}
+}
+
+// RegionKey returns the key of the region the AMI is used in.
+func (a AMI) RegionKey() RegionKey {
+	return RegionKey{Account: a.Account, Region: a.Region}
+}
+
+// Result holds everything a scan found, grouped by whoAMI status. The category maps are keyed by account, region and
+// AMI ID.
+type Result struct {
+	// Identity is the caller identity of the scan. When several accounts are scanned, it is the identity that assumed
+	// a role in each of them.
+	Identity Identity
+	// Accounts are the IDs of the scanned accounts, in scan order
+	Accounts []string
+	// Regions are the regions scanned in each account, in scan order
+	Regions []RegionKey
+	// ScannedAt is when the scan started
+	ScannedAt time.Time
+
+	// AllowedAMIStateByRegion holds the "Allowed AMIs" state ("enabled", "audit-mode", "disabled") of each region
+	AllowedAMIStateByRegion    map[RegionKey]string
+	AllowedAMIAccountsByRegion map[RegionKey][]string
+	// AllowedAMIPermissionDenied is set when ec2:GetAllowedImagesSettings was denied in any scanned account, in which
+	// case the Allowed AMIs state of that account's regions is unknown
+	AllowedAMIPermissionDenied bool
+
+	// Errors lists the parts of the scan that failed. When it is not empty the scan is incomplete: instances and AMIs
+	// may be missing from the result even though every API call was retried.
+	Errors []ScanError
+	// AccountErrors lists the accounts that could not be scanned at all. They are missing from Accounts.
+	AccountErrors []AccountError
+
+	TotalInstances int
+	ProcessedAMIs  map[AMIKey]bool
+	AMIToInstances map[AMIKey][]Instance
+
+	VerifiedAMIs      map[AMIKey]AMI
+	SelfHostedAMIs    map[AMIKey]AMI
+	AllowedAMIs       map[AMIKey]AMI
+	TrustedAMIs       map[AMIKey]AMI
+	PrivateSharedAMIs map[AMIKey]AMI
+	// UnknownAMIs have an owner alias that none of the classification rules recognize
+	UnknownAMIs            map[AMIKey]AMI
+	UnverifiedButKnownAMIs map[AMIKey]AMI
+	UnverifiedAMIs         map[AMIKey]AMI
+}
+
+func newResult() *Result {
+	return &Result{
+		AllowedAMIStateByRegion:    make(map[RegionKey]string),
+		AllowedAMIAccountsByRegion: make(map[RegionKey][]string),
+		ProcessedAMIs:              make(map[AMIKey]bool),
+		AMIToInstances:             make(map[AMIKey][]Instance),
+		VerifiedAMIs:               make(map[AMIKey]AMI),
+		SelfHostedAMIs:             make(map[AMIKey]AMI),
+		AllowedAMIs:                make(map[AMIKey]AMI),
+		TrustedAMIs:                make(map[AMIKey]AMI),
+		PrivateSharedAMIs:          make(map[AMIKey]AMI),
+		UnknownAMIs:                make(map[AMIKey]AMI),
+		UnverifiedButKnownAMIs:     make(map[AMIKey]AMI),
+		UnverifiedAMIs:             make(map[AMIKey]AMI),
+	}
+}
+
+// ErrAMINotFound is reported when neither ec2:DescribeImages nor ec2:DescribeInstanceImageMetadata returned the
+// details of an AMI.
+var ErrAMINotFound = errors.New("AMI details not found")
+
+// ScanError records a part of the scan that failed after retries.
+type ScanError struct {
+	Account string
+	Region  string
+	// Operation is the EC2 API operation that failed
+	Operation string
+	// Resources are the IDs of the AMIs in Region that could not be looked up. They are either not classified or
+	// classified from the partial details in instance metadata. When empty, the failure affects the whole region.
+	Resources []string
+	Err       error
+}
+
+func (e ScanError) Error() string {
+	location := e.Region
+	if e.Account != "" {
+		location = e.Account + " " + e.Region
+	}
+	if len(e.Resources) > 0 {
+		return fmt.Sprintf("[%s] ec2:%s failed for %s: %v", location, e.Operation, strings.Join(e.Resources, ", "), e.Err)
+	}
+	return fmt.Sprintf("[%s] ec2:%s failed: %v", location, e.Operation, e.Err)
+}
+
+// RegionKey returns the key of the region the failure happened in.
+func (e ScanError) RegionKey() RegionKey {
+	return RegionKey{Account: e.Account, Region: e.Region}
+}
+
+func (e ScanError) Unwrap() error {
+	return e.Err
+}
+
+// AccountError records an account that could not be scanned, for instance because its role could not be assumed.
+type AccountError struct {
+	Account string
+	Err     error
+}
+
+func (e AccountError) Error() string {
+	return fmt.Sprintf("[%s] account scan failed: %v", e.Account, e.Err)
+}
+
+func (e AccountError) Unwrap() error {
+	return e.Err
+}
+
+// RequestID returns the AWS request ID of the failed call, which can be looked up in CloudTrail, or "" if the call
+// did not reach AWS.
+func RequestID(err error) string {
+	var responseErr interface{ ServiceRequestID() string }
+	if errors.As(err, &responseErr) {
+		return responseErr.ServiceRequestID()
+	}
+	return ""
+}
+
+// Incomplete reports whether any part of the scan failed.
+func (r *Result) Incomplete() bool {
+	return len(r.Errors) > 0 || len(r.AccountErrors) > 0
+}
+
+// IncompleteRegions returns the regions in which part of the scan failed, in scan order.
+func (r *Result) IncompleteRegions() []RegionKey {
+	var regions []RegionKey
+	for _, region := range r.Regions {
+		for _, err := range r.Errors {
+			if err.RegionKey() == region {
+				regions = append(regions, region)
+				break
+			}
+		}
+	}
+	return regions
+}
+
+// MultiAccount reports whether the result spans several accounts, in which case regions are only unique together
+// with their account.
+func (r *Result) MultiAccount() bool {
+	return len(r.Accounts)+len(r.AccountErrors) > 1
+}
+
+// RegionLabel returns the name of a region for display: the region name, prefixed with the account ID when the
+// result spans several accounts.
+func (r *Result) RegionLabel(region RegionKey) string {
+	if r.MultiAccount() {
+		return region.Account + "/" + region.Region
+	}
+	return region.Region
+}
+
+// AMIs returns every classified AMI, ordered by account and region (in scan order) and then by AMI ID.
+func (r *Result) AMIs() []AMI {
+	var amis []AMI
+	for _, category := range []map[AMIKey]AMI{r.VerifiedAMIs, r.SelfHostedAMIs, r.AllowedAMIs, r.TrustedAMIs,
+		r.PrivateSharedAMIs, r.UnverifiedButKnownAMIs, r.UnverifiedAMIs, r.UnknownAMIs} {
+		for _, ami := range category {
+			amis = append(amis, ami)
+		}
+	}
+	regionIndex := make(map[RegionKey]int, len(r.Regions))
+	for i, region := range r.Regions {
+		regionIndex[region] = i
+	}
+	slices.SortFunc(amis, func(a, b AMI) int {
+		if a.RegionKey() != b.RegionKey() {
+			return regionIndex[a.RegionKey()] - regionIndex[b.RegionKey()]
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return amis
+}
+
+// Instances returns the instances launched from an AMI.
+func (r *Result) Instances(ami AMI) []Instance {
+	return r.AMIToInstances[ami.Key()]
+}
+
+// CountByStatus returns the number of AMIs with each status.
+func (r *Result) CountByStatus() map[Status]int {
+	counts := make(map[Status]int)
+	for _, ami := range r.AMIs() {
+		counts[ami.Status]++
+	}
+	return counts
+}
+
+// add records a classified AMI in the category map matching its status.
+func (r *Result) add(ami AMI) {
+	switch ami.Status {
+	case StatusVerified:
+		r.VerifiedAMIs[ami.Key()] = ami
+	case StatusSelfHosted:
+		r.SelfHostedAMIs[ami.Key()] = ami
+	case StatusAllowed:
+		r.AllowedAMIs[ami.Key()] = ami
+	case StatusTrusted:
+		r.TrustedAMIs[ami.Key()] = ami
+	case StatusPrivateShared:
+		r.PrivateSharedAMIs[ami.Key()] = ami
+	case StatusUnknown:
+		r.UnknownAMIs[ami.Key()] = ami
+	case StatusUnverifiedButKnown:
+		r.UnverifiedButKnownAMIs[ami.Key()] = ami
+	case StatusUnverified:
+		r.UnverifiedAMIs[ami.Key()] = ami
+	}
+}
+
+// CountRegionsWithAllowedAmisEnabled returns the number of scanned regions whose Allowed AMIs state is enabled,
+// audit-mode and disabled, in that order.
+func (r *Result) CountRegionsWithAllowedAmisEnabled() (int, int, int) {
+	return countRegionsWithAllowedAmisEnabled(r.Regions, r.AllowedAMIStateByRegion)
+}
+
+func countRegionsWithAllowedAmisEnabled(regions []RegionKey, allowedAMIStateByRegion map[RegionKey]string) (int, int, int) {
+	var enabledCount, auditModeCount, disabledCount int
+	for _, region := range regions {
+		switch allowedAMIStateByRegion[region] {
+		case "enabled":
+			enabledCount++
+		case "audit-mode":
+			auditModeCount++
+		default:
+			disabledCount++
+		}
+	}
+	return enabledCount, auditModeCount, disabledCount
+}
@@ -0,0 +1,44 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// checkFields returns an error pointing at the first key of a mapping node that is not one of fields. Node.Decode does
+// not reject unknown fields, and a misspelt optional field would otherwise be silently ignored.
+func checkFields(name string, node *yaml.Node, fields ...string) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s:%d: expected a mapping with the fields %s", name, node.Line, strings.Join(fields, ", "))
+	}
+	for i := 0; i < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if !slices.Contains(fields, key.Value) {
+			return fmt.Errorf("%s:%d: unknown field %q, expected one of %s", name, key.Line, key.Value,
+				strings.Join(fields, ", "))
+		}
+	}
+	return nil
+}
+
+// yamlLinePattern matches the position yaml.v3 puts at the start of its error messages.
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): `)
+
+// yamlError rewrites a yaml.v3 error as "name:line: message", the form of the other validation errors. Only the
+// first of several type errors is kept.
+func yamlError(name string, err error) error {
+	message := err.Error()
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) && len(typeErr.Errors) > 0 {
+		message = typeErr.Errors[0]
+	}
+	if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+		return fmt.Errorf("%s:%s: %s", name, match[1], message[len(match[0]):])
+	}
+	return fmt.Errorf("%s: %s", name, strings.TrimPrefix(message, "yaml: "))
+}